@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"fmt"
+	"strconv"
+
+	b "github.com/end1essrage/indigo-core/bot"
+)
+
+const (
+	DefaultPageSize = 6
+	// служебное действие листания меню
+	pageAction = "page"
+	// кнопок в ряду
+	rowSize = 2
+)
+
+// Sender отправка клавиатуры с меню
+type Sender interface {
+	SendKeyboard(chatId int64, text string, mesh b.MeshInlineKeyboard) error
+}
+
+// Context данные нажатия кнопки меню
+type Context struct {
+	AdminId int64
+	// данные кнопки (например номер страницы или id сущности)
+	Args string
+}
+
+type Handler func(ctx *Context) error
+
+// Action пункт админ меню
+type Action struct {
+	Code    string
+	Title   string
+	Handler Handler
+	// скрытые действия не выводятся в меню, но вызываются кнопками других действий
+	Hidden bool
+}
+
+// Menu реестр действий админ меню, порядок кнопок - порядок регистрации
+type Menu struct {
+	sender   Sender
+	pageSize int
+	actions  []Action
+	index    map[string]int
+}
+
+func NewMenu(sender Sender, pageSize int) *Menu {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &Menu{sender: sender, pageSize: pageSize, index: make(map[string]int)}
+}
+
+// Register добавляет действие, коды должны быть уникальны
+func (m *Menu) Register(a Action) error {
+	if a.Code == "" || a.Code == pageAction {
+		return fmt.Errorf("недопустимый код действия %q", a.Code)
+	}
+	if _, ok := m.index[a.Code]; ok {
+		return fmt.Errorf("действие %s уже зарегистрировано", a.Code)
+	}
+
+	m.index[a.Code] = len(m.actions)
+	m.actions = append(m.actions, a)
+	return nil
+}
+
+// Button кнопка вызова действия, для вложенных клавиатур действий
+func Button(text, code, args string) b.MeshInlineButton {
+	return b.MeshInlineButton{Text: text, Script: b.NamespacedScript(b.CbNamespace_Admin, code), CustomCbData: args}
+}
+
+// Show отправляет страницу меню
+func (m *Menu) Show(chatId int64, page int) error {
+	return m.sender.SendKeyboard(chatId, "меню:", m.Keyboard(page))
+}
+
+// Keyboard страница меню с кнопками листания
+func (m *Menu) Keyboard(page int) b.MeshInlineKeyboard {
+	visible := m.visible()
+	pages := (len(visible) + m.pageSize - 1) / m.pageSize
+	if page < 0 || page >= pages {
+		page = 0
+	}
+
+	var keyboard b.MeshInlineKeyboard
+
+	start := page * m.pageSize
+	end := min(start+m.pageSize, len(visible))
+
+	var row []b.MeshInlineButton
+	for _, a := range visible[start:end] {
+		row = append(row, Button(a.Title, a.Code, ""))
+		if len(row) == rowSize {
+			keyboard.Rows = append(keyboard.Rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard.Rows = append(keyboard.Rows, row)
+	}
+
+	if pages > 1 {
+		var nav []b.MeshInlineButton
+		if page > 0 {
+			nav = append(nav, Button("◀", pageAction, strconv.Itoa(page-1)))
+		}
+		if page < pages-1 {
+			nav = append(nav, Button("▶", pageAction, strconv.Itoa(page+1)))
+		}
+		keyboard.Rows = append(keyboard.Rows, nav)
+	}
+
+	return keyboard
+}
+
+// Handle выполняет действие по коду из кнопки
+func (m *Menu) Handle(code string, ctx *Context) error {
+	if code == pageAction {
+		page, _ := strconv.Atoi(ctx.Args)
+		return m.Show(ctx.AdminId, page)
+	}
+
+	i, ok := m.index[code]
+	if !ok {
+		return fmt.Errorf("неизвестное действие %s", code)
+	}
+
+	return m.actions[i].Handler(ctx)
+}
+
+func (m *Menu) visible() []Action {
+	result := make([]Action, 0, len(m.actions))
+	for _, a := range m.actions {
+		if !a.Hidden {
+			result = append(result, a)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"fmt"
+	"testing"
+
+	b "github.com/end1essrage/indigo-core/bot"
+)
+
+type fakeSender struct {
+	sent []b.MeshInlineKeyboard
+}
+
+func (f *fakeSender) SendKeyboard(chatId int64, text string, mesh b.MeshInlineKeyboard) error {
+	f.sent = append(f.sent, mesh)
+	return nil
+}
+
+func buttons(kb b.MeshInlineKeyboard) []b.MeshInlineButton {
+	var result []b.MeshInlineButton
+	for _, row := range kb.Rows {
+		result = append(result, row...)
+	}
+	return result
+}
+
+func TestMenuPaging(t *testing.T) {
+	menu := NewMenu(&fakeSender{}, 2)
+	for i := 0; i < 5; i++ {
+		code := fmt.Sprintf("a%d", i)
+		if err := menu.Register(Action{Code: code, Title: code, Handler: func(*Context) error { return nil }}); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	}
+	menu.Register(Action{Code: "hidden", Hidden: true, Handler: func(*Context) error { return nil }})
+
+	first := buttons(menu.Keyboard(0))
+	// 2 действия + вперед
+	if len(first) != 3 || first[2].Script != "adm:page" || first[2].CustomCbData != "1" {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+
+	last := buttons(menu.Keyboard(2))
+	// последнее действие + назад
+	if len(last) != 2 || last[0].Script != "adm:a4" || last[1].CustomCbData != "1" {
+		t.Fatalf("unexpected last page %+v", last)
+	}
+
+	// несуществующая страница - первая
+	if got := buttons(menu.Keyboard(10)); got[0].Script != "adm:a0" {
+		t.Errorf("expected first page, got %+v", got)
+	}
+}
+
+func TestMenuHandle(t *testing.T) {
+	sender := &fakeSender{}
+	menu := NewMenu(sender, 0)
+
+	var called *Context
+	menu.Register(Action{Code: "stats", Title: "Статистика", Handler: func(ctx *Context) error {
+		called = ctx
+		return nil
+	}})
+
+	if err := menu.Register(Action{Code: "stats"}); err == nil {
+		t.Error("expected error for duplicated code")
+	}
+	if err := menu.Register(Action{Code: "page"}); err == nil {
+		t.Error("expected error for reserved code")
+	}
+
+	if err := menu.Handle("stats", &Context{AdminId: 1, Args: "x"}); err != nil || called == nil || called.Args != "x" {
+		t.Fatalf("action was not called: %v", err)
+	}
+
+	if err := menu.Handle("page", &Context{AdminId: 1, Args: "0"}); err != nil || len(sender.sent) != 1 {
+		t.Fatalf("page was not sent: %v", err)
+	}
+
+	if err := menu.Handle("unknown", &Context{AdminId: 1}); err == nil {
+		t.Error("expected error for unknown action")
+	}
+}
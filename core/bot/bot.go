@@ -1,6 +1,12 @@
 package bot
 
 import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	c "github.com/end1essrage/indigo-core/config"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
@@ -8,14 +14,49 @@ import (
 type CbData struct {
 	Script *string `json:"script,omitempty"`
 	Data   *string `json:"data,omitempty"`
+	// роли которым доступна кнопка
+	Roles []string `json:"roles,omitempty"`
+	// что сделать с сообщением после нажатия (keep/edit/delete)
+	OnPress string `json:"on_press,omitempty"`
 }
 
 type TgBot struct {
-	bot *tgbotapi.BotAPI
+	bot       *tgbotapi.BotAPI
+	callbacks *CallbackRegistry
+	// id нажатий на которые уже ответили (тг не дает ответить дважды)
+	answered sync.Map
+	// хранилище медиа для отправки файлов по ключу, может быть nil
+	media MediaResolver
+}
+
+func NewBot(b *tgbotapi.BotAPI, callbacks *CallbackRegistry) *TgBot {
+	return &TgBot{bot: b, callbacks: callbacks}
+}
+
+// InlineKeyboard разметка инлайн клавиатуры
+func (t *TgBot) InlineKeyboard(mesh MeshInlineKeyboard) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: t.callbacks.InlineKeyboard(mesh)}
+}
+
+// ResolveCallback проверяет и разворачивает упакованные данные кнопки в полный json для дальнейшей обработки
+func (t *TgBot) ResolveCallback(query *tgbotapi.CallbackQuery) (CbData, error) {
+	d, err := t.callbacks.Decode(query.Data)
+	if err != nil {
+		return d, err
+	}
+
+	body, err := json.Marshal(d)
+	if err != nil {
+		return d, err
+	}
+
+	query.Data = string(body)
+	return d, nil
 }
 
-func NewBot(b *tgbotapi.BotAPI) *TgBot {
-	return &TgBot{bot: b}
+// UserName имя бота, нужно для разбора команд вида /cmd@botname
+func (t *TgBot) UserName() string {
+	return t.bot.Self.UserName
 }
 
 func (t *TgBot) SendMessage(chatId int64, text string) error {
@@ -32,13 +73,17 @@ func (t *TgBot) Send(msg tgbotapi.MessageConfig) error {
 	return err
 }
 
-// автоматически если много кнопок реализовать переключалку через сервис
+// SendKeyboard если рядов больше чем влезает на страницу - добавляется листание
 func (t *TgBot) SendKeyboard(chatId int64, text string, mesh MeshInlineKeyboard) error {
 	msg := tgbotapi.NewMessage(chatId, text)
 	logrus.Infof("%+v", mesh)
-	msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-		InlineKeyboard: CreateInlineKeyboard(mesh),
+
+	markup, err := t.markup(mesh)
+	if err != nil {
+		logrus.Errorf("Error paginating keyboard: %v", err)
+		return err
 	}
+	msg.ReplyMarkup = markup
 
 	if err := t.Send(msg); err != nil {
 		logrus.Errorf("Error sending keyboard: %v", err)
@@ -48,6 +93,99 @@ func (t *TgBot) SendKeyboard(chatId int64, text string, mesh MeshInlineKeyboard)
 	return nil
 }
 
+// markup разметка клавиатуры, если рядов больше чем влезает на страницу - добавляется листание
+func (t *TgBot) markup(mesh MeshInlineKeyboard) (tgbotapi.InlineKeyboardMarkup, error) {
+	size := mesh.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if len(mesh.Rows) > size {
+		paged, err := t.paginate(mesh, size)
+		if err != nil {
+			return tgbotapi.InlineKeyboardMarkup{}, err
+		}
+		mesh = paged
+	}
+
+	return t.InlineKeyboard(mesh), nil
+}
+
+// EditText меняет текст сообщения, mesh - новая клавиатура (nil - убрать)
+func (t *TgBot) EditText(chatId int64, msgId int, text string, mesh *MeshInlineKeyboard) error {
+	edit := tgbotapi.NewEditMessageText(chatId, msgId, text)
+	if mesh != nil {
+		markup, err := t.markup(*mesh)
+		if err != nil {
+			return err
+		}
+		edit.ReplyMarkup = &markup
+	}
+
+	_, err := t.bot.Request(edit)
+	return err
+}
+
+// EditMarkup меняет клавиатуру сообщения, nil - убрать клавиатуру
+func (t *TgBot) EditMarkup(chatId int64, msgId int, mesh *MeshInlineKeyboard) error {
+	markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if mesh != nil {
+		var err error
+		if markup, err = t.markup(*mesh); err != nil {
+			return err
+		}
+	}
+
+	_, err := t.bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatId, msgId, markup))
+	return err
+}
+
+// AnswerCallback ответ на нажатие: всплывающее уведомление или окно (alert)
+func (t *TgBot) AnswerCallback(queryId string, text string, alert bool) error {
+	if _, loaded := t.answered.LoadOrStore(queryId, struct{}{}); loaded {
+		return fmt.Errorf("на нажатие %s уже ответили", queryId)
+	}
+
+	cfg := tgbotapi.NewCallback(queryId, text)
+	cfg.ShowAlert = alert
+
+	_, err := t.bot.Request(cfg)
+	return err
+}
+
+// FinishCallback отвечает на нажатие если скрипт этого не сделал, иначе у кнопки крутятся часики
+// вызывается один раз в конце обработки обновления и убирает запись об ответе
+func (t *TgBot) FinishCallback(queryId string) {
+	if _, loaded := t.answered.LoadAndDelete(queryId); loaded {
+		return
+	}
+
+	if _, err := t.bot.Request(tgbotapi.NewCallback(queryId, "")); err != nil {
+		logrus.Debugf("ошибка ответа на нажатие: %v", err)
+	}
+}
+
+// ApplyPress обрабатывает сообщение с клавиатурой после нажатия по режиму кнопки
+func (t *TgBot) ApplyPress(query *tgbotapi.CallbackQuery, mode string) {
+	if query.Message == nil {
+		return
+	}
+
+	chatId, msgId := query.Message.Chat.ID, query.Message.MessageID
+
+	var err error
+	switch c.PressMode(mode) {
+	case c.PressMode_Keep:
+	case c.PressMode_Edit:
+		err = t.EditMarkup(chatId, msgId, nil)
+	default:
+		err = t.DeleteMsg(chatId, msgId)
+	}
+
+	if err != nil {
+		logrus.Debugf("ошибка обработки сообщения после нажатия: %v", err)
+	}
+}
+
 func (t *TgBot) DeleteMsg(chatId int64, msgId int) error {
 	d := tgbotapi.NewDeleteMessage(chatId, msgId)
 	_, err := t.bot.Send(d)
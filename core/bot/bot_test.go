@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeAPI апи тг, которое на все отвечает успехом и считает ответы на нажатия
+func fakeAPI(t *testing.T, answers *int) *tgbotapi.BotAPI {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`))
+		case strings.HasSuffix(r.URL.Path, "/answerCallbackQuery"):
+			*answers++
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient failed: %v", err)
+	}
+	return api
+}
+
+func TestFinishCallback(t *testing.T) {
+	var answers int
+	bot := NewBot(fakeAPI(t, &answers), nil)
+
+	// скрипт ответил сам - повторно не отвечаем, запись об ответе удаляется
+	if err := bot.AnswerCallback("1", "ok", false); err != nil {
+		t.Fatalf("AnswerCallback failed: %v", err)
+	}
+	if err := bot.AnswerCallback("1", "again", false); err == nil {
+		t.Error("second answer should fail")
+	}
+	bot.FinishCallback("1")
+
+	// скрипт не ответил - отвечаем пустым
+	bot.FinishCallback("2")
+
+	if answers != 2 {
+		t.Errorf("answers = %d, want 2", answers)
+	}
+	bot.answered.Range(func(k, _ any) bool {
+		t.Errorf("answered entry %v left after FinishCallback", k)
+		return true
+	})
+}
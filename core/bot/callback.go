@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// пространства имен внутренних кнопок, имена скриптов с ними не пересекаются (в путях нет ':')
+const (
+	CbNamespace_Admin = "adm"
+	CbNamespace_Form  = "fm"
+)
+
+// NamespacedScript код внутренней кнопки вида adm:roles
+func NamespacedScript(namespace, action string) string {
+	return namespace + ":" + action
+}
+
+// ParseNamespacedScript разбирает код внутренней кнопки, ok=false для обычных скриптов
+func ParseNamespacedScript(script string) (namespace, action string, ok bool) {
+	namespace, action, ok = strings.Cut(script, ":")
+	if !ok || namespace == "" {
+		return "", "", false
+	}
+	return namespace, action, true
+}
+
+const (
+	// лимит тг на callback_data
+	callbackDataLimit  = 64
+	DefaultCallbackTTL = 24 * time.Hour
+
+	// короткие данные без ролей кладутся в кнопку с подписью: i<sign><script>\x1f<data>[\x1f<on_press>]
+	// данные кнопки присылает клиент, без подписи он мог бы запустить любой скрипт
+	cbPrefixInline = "i"
+	// длинные данные и кнопки с ролями хранятся в кэше, в кнопке только токен: t<token>
+	cbPrefixToken = "t"
+	cbSeparator   = "\x1f"
+	cbKeyPrefix   = "cb:"
+	// 8 байт hmac в base64
+	cbSignLen = 11
+)
+
+// CallbackStore хранилище полных данных кнопок
+type CallbackStore interface {
+	GetString(key string) string
+	SetStringTTL(key string, val string, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// CallbackRegistry упаковывает данные кнопок в 64 байта тг
+// принимаются только данные, выданные самим реестром: подписанные или лежащие в кэше
+type CallbackRegistry struct {
+	store CallbackStore
+	ttl   time.Duration
+	// ключ подписи, у всех экземпляров бота один
+	secret []byte
+}
+
+func NewCallbackRegistry(store CallbackStore, ttl time.Duration, secret string) *CallbackRegistry {
+	if ttl <= 0 {
+		ttl = DefaultCallbackTTL
+	}
+	return &CallbackRegistry{store: store, ttl: ttl, secret: []byte(secret)}
+}
+
+func (r *CallbackRegistry) sign(payload string) string {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Encode компактная запись если влезает в лимит, иначе токен на запись в кэше
+func (r *CallbackRegistry) Encode(d CbData) (string, error) {
+	var script, data string
+	if d.Script != nil {
+		script = *d.Script
+	}
+	if d.Data != nil {
+		data = *d.Data
+	}
+
+	// разделитель внутри значений сломал бы разбор, такие данные и кнопки с ролями только через токен
+	if len(d.Roles) == 0 && !strings.Contains(script+data+d.OnPress, cbSeparator) {
+		payload := script + cbSeparator + data
+		if d.OnPress != "" {
+			payload += cbSeparator + d.OnPress
+		}
+		inline := cbPrefixInline + r.sign(payload) + payload
+		if len(inline) <= callbackDataLimit {
+			return inline, nil
+		}
+	}
+
+	body, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+
+	// одинаковые кнопки получают один токен, повторная запись продлевает ttl
+	sum := sha256.Sum256(body)
+	token := base64.RawURLEncoding.EncodeToString(sum[:12])
+
+	if err := r.store.SetStringTTL(cbKeyPrefix+token, string(body), r.ttl); err != nil {
+		return "", err
+	}
+
+	return cbPrefixToken + token, nil
+}
+
+// Decode разбирает данные кнопки, данные без подписи или не из кэша не принимаются
+// роли есть только у кнопок из кэша, подписанные кнопки создавались без ролей
+func (r *CallbackRegistry) Decode(raw string) (CbData, error) {
+	var d CbData
+
+	switch {
+	case strings.HasPrefix(raw, cbPrefixInline):
+		raw = raw[len(cbPrefixInline):]
+		if len(raw) < cbSignLen {
+			return d, fmt.Errorf("некорректные данные кнопки")
+		}
+		sign, payload := raw[:cbSignLen], raw[cbSignLen:]
+		if !hmac.Equal([]byte(sign), []byte(r.sign(payload))) {
+			return d, fmt.Errorf("неверная подпись данных кнопки")
+		}
+
+		parts := strings.Split(payload, cbSeparator)
+		if len(parts) < 2 || len(parts) > 3 {
+			return d, fmt.Errorf("некорректные данные кнопки")
+		}
+		d.Script = &parts[0]
+		d.Data = &parts[1]
+		if len(parts) == 3 {
+			d.OnPress = parts[2]
+		}
+		return d, nil
+
+	case strings.HasPrefix(raw, cbPrefixToken):
+		body := r.store.GetString(cbKeyPrefix + raw[len(cbPrefixToken):])
+		if body == "" {
+			return d, fmt.Errorf("данные кнопки устарели")
+		}
+		if err := json.Unmarshal([]byte(body), &d); err != nil {
+			return d, fmt.Errorf("некорректные данные кнопки: %w", err)
+		}
+		return d, nil
+	}
+
+	return d, fmt.Errorf("неизвестный формат данных кнопки")
+}
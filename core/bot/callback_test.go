@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/cache"
+)
+
+func TestCallbackRegistry(t *testing.T) {
+	store := cache.NewInMemoryCache(time.Minute)
+	defer store.Stop()
+	r := NewCallbackRegistry(store, time.Minute, "secret")
+
+	short := MeshInlineButton{Script: "menu/buy", CustomCbData: "42", Roles: []string{"vip"}}
+	keep := MeshInlineButton{Script: "menu/info", CustomCbData: "42", OnPress: "keep"}
+	long := MeshInlineButton{Script: "shop/catalog/items/details", CustomCbData: strings.Repeat("x", 80)}
+
+	for _, btn := range []MeshInlineButton{short, keep, long} {
+		raw, err := r.Encode(btn.cbData())
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if len(raw) > callbackDataLimit {
+			t.Fatalf("callback data exceeds limit: %d bytes", len(raw))
+		}
+
+		d, err := r.Decode(raw)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if *d.Script != btn.Script || *d.Data != btn.CustomCbData || len(d.Roles) != len(btn.Roles) || d.OnPress != btn.OnPress {
+			t.Errorf("roundtrip mismatch: %+v", d)
+		}
+	}
+
+	// одинаковые длинные кнопки получают один токен
+	a, _ := r.Encode(long.cbData())
+	b, _ := r.Encode(long.cbData())
+	if a != b || !strings.HasPrefix(a, cbPrefixToken) {
+		t.Errorf("expected same token, got %s and %s", a, b)
+	}
+
+	for _, bad := range []string{"", "garbage", "tunknowntoken", "{broken", "ionlyscript"} {
+		if _, err := r.Decode(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestCallbackForged(t *testing.T) {
+	store := cache.NewInMemoryCache(time.Minute)
+	defer store.Stop()
+	r := NewCallbackRegistry(store, time.Minute, "secret")
+
+	// кнопка с ролями всегда уходит токеном
+	raw, err := r.Encode(MeshInlineButton{Script: "shop/refund", CustomCbData: "1", Roles: []string{"admin"}}.cbData())
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.HasPrefix(raw, cbPrefixToken) {
+		t.Errorf("button with roles should be a token, got %q", raw)
+	}
+
+	signed, err := r.Encode(MeshInlineButton{Script: "menu/buy", CustomCbData: "42"}.cbData())
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	sign := signed[len(cbPrefixInline) : len(cbPrefixInline)+cbSignLen]
+	other, _ := NewCallbackRegistry(store, time.Minute, "other").Encode(MeshInlineButton{Script: "shop/refund", CustomCbData: "1"}.cbData())
+
+	testCases := []struct {
+		name string
+		raw  string
+	}{
+		{name: "unsigned", raw: "ishop/refund\x1f1"},
+		{name: "old roles slot", raw: "i" + sign + "menu/buy\x1f42\x1f\x1fkeep"},
+		{name: "changed script", raw: "i" + sign + "shop/refund\x1f42"},
+		{name: "changed data", raw: "i" + sign + "menu/buy\x1f43"},
+		{name: "other secret", raw: other},
+		{name: "legacy json", raw: `{"script":"shop/refund","data":"1"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := r.Decode(tc.raw); err == nil {
+				t.Errorf("expected error for %q", tc.raw)
+			}
+		})
+	}
+}
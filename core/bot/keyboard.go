@@ -1,9 +1,6 @@
 package bot
 
 import (
-	"encoding/json"
-	"fmt"
-
 	c "github.com/end1essrage/indigo-core/config"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
@@ -12,6 +9,8 @@ import (
 
 type MeshInlineKeyboard struct {
 	Rows [][]MeshInlineButton
+	// рядов на странице, 0 - DefaultPageSize
+	PageSize int
 }
 
 type MeshInlineButton struct {
@@ -19,27 +18,29 @@ type MeshInlineButton struct {
 	Text         string
 	CustomCbData string
 	Script       string
+	Roles        []string
+	OnPress      string
 }
 
-func (b MeshInlineButton) formatCbData() string {
-	data := CbData{Data: &b.CustomCbData, Script: &b.Script}
-	body, err := json.Marshal(data)
-	if err != nil {
-		logrus.Error("ошибка сериализации")
-	}
-	return fmt.Sprintf("%s", body)
+func (b MeshInlineButton) cbData() CbData {
+	return CbData{Data: &b.CustomCbData, Script: &b.Script, Roles: b.Roles, OnPress: b.OnPress}
 }
 
-func CreateInlineKeyboard(mesh MeshInlineKeyboard) [][]tgbotapi.InlineKeyboardButton {
+// InlineKeyboard собирает кнопки, данные кнопок упаковываются в лимит тг
+func (r *CallbackRegistry) InlineKeyboard(mesh MeshInlineKeyboard) [][]tgbotapi.InlineKeyboardButton {
 	keyboard := make([][]tgbotapi.InlineKeyboardButton, 0)
 	//проходимся по блоку Buttons по каждому Row
-	for _, r := range mesh.Rows {
+	for _, meshRow := range mesh.Rows {
 		row := make([]tgbotapi.InlineKeyboardButton, 0)
 		//проходимся по кнопкам внутри Row
-		for _, b := range r {
+		for _, b := range meshRow {
 			//заполняем CallBackData
-			btn := tgbotapi.NewInlineKeyboardButtonData(b.Text, b.formatCbData())
-			row = append(row, btn)
+			data, err := r.Encode(b.cbData())
+			if err != nil {
+				logrus.Errorf("ошибка упаковки данных кнопки %s: %v", b.Text, err)
+				continue
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(b.Text, data))
 		}
 		keyboard = append(keyboard, row)
 	}
@@ -51,7 +52,16 @@ func CreateInlineKeyboard(mesh MeshInlineKeyboard) [][]tgbotapi.InlineKeyboardBu
 func FromLuaTableToMeshInlineKeyboard(lt *lua.LTable) MeshInlineKeyboard {
 	var mesh MeshInlineKeyboard
 
+	var onPress string
 	lt.ForEach(func(key lua.LValue, value lua.LValue) {
+		if key.String() == "OnPress" {
+			onPress = value.String()
+		}
+		if key.String() == "PageSize" {
+			if n, ok := value.(lua.LNumber); ok {
+				mesh.PageSize = int(n)
+			}
+		}
 		if key.String() == "Rows" {
 			if rows, ok := value.(*lua.LTable); ok {
 				rows.ForEach(func(rowKey lua.LValue, rowValue lua.LValue) {
@@ -70,6 +80,14 @@ func FromLuaTableToMeshInlineKeyboard(lt *lua.LTable) MeshInlineKeyboard {
 										meshBtn.CustomCbData = fieldValue.String()
 									case "Name":
 										meshBtn.Name = fieldValue.String()
+									case "OnPress":
+										meshBtn.OnPress = fieldValue.String()
+									case "Roles":
+										if roles, ok := fieldValue.(*lua.LTable); ok {
+											roles.ForEach(func(_ lua.LValue, role lua.LValue) {
+												meshBtn.Roles = append(meshBtn.Roles, role.String())
+											})
+										}
 									}
 								})
 								meshRow = append(meshRow, meshBtn)
@@ -82,19 +100,33 @@ func FromLuaTableToMeshInlineKeyboard(lt *lua.LTable) MeshInlineKeyboard {
 		}
 	})
 
+	// режим клавиатуры для кнопок без своего
+	if onPress != "" {
+		for _, row := range mesh.Rows {
+			for i := range row {
+				if row[i].OnPress == "" {
+					row[i].OnPress = onPress
+				}
+			}
+		}
+	}
+
 	return mesh
 }
 
 // функция для конвертации конфига в MeshKeyboard
 func ParseInlineKeyboard(kb *c.Keyboard) MeshInlineKeyboard {
-	kbMesh := MeshInlineKeyboard{}
+	kbMesh := MeshInlineKeyboard{PageSize: kb.PageSize}
 
 	//проходимся по блоку Buttons по каждому Row
 	for _, r := range *kb.Buttons {
 		row := make([]MeshInlineButton, 0)
 		//проходимся по кнопкам внутри Row
 		for _, b := range r.Row {
-			btn := MeshInlineButton{Text: b.Text}
+			btn := MeshInlineButton{Text: b.Text, Roles: b.Roles, OnPress: string(kb.OnPress)}
+			if b.OnPress != "" {
+				btn.OnPress = string(b.OnPress)
+			}
 			//заполняем CallBackData
 			if b.Script != nil {
 				btn.Script = *b.Script
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	c "github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// методы и поля апи для отправки вложений
+var mediaMethods = map[c.MediaKind]struct{ endpoint, field string }{
+	c.MediaKind_Photo:     {"sendPhoto", "photo"},
+	c.MediaKind_Document:  {"sendDocument", "document"},
+	c.MediaKind_Audio:     {"sendAudio", "audio"},
+	c.MediaKind_Video:     {"sendVideo", "video"},
+	c.MediaKind_Voice:     {"sendVoice", "voice"},
+	c.MediaKind_Animation: {"sendAnimation", "animation"},
+}
+
+// в альбом тг принимает только эти типы
+var albumKinds = map[c.MediaKind]bool{
+	c.MediaKind_Photo:    true,
+	c.MediaKind_Document: true,
+	c.MediaKind_Audio:    true,
+	c.MediaKind_Video:    true,
+}
+
+var downloadClient = &http.Client{Timeout: time.Minute}
+
+// MediaResolver отдает содержимое файла из хранилища медиа по ключу
+type MediaResolver interface {
+	Open(key string) (name string, r io.ReadCloser, err error)
+}
+
+// MediaSource откуда брать файл, заполняется одно поле
+type MediaSource struct {
+	// файл уже загруженный в тг
+	FileId string
+	Url    string
+	// ключ в хранилище медиа
+	Key string
+}
+
+// MediaItem элемент альбома
+type MediaItem struct {
+	Kind    c.MediaKind
+	Source  MediaSource
+	Caption string
+}
+
+// SetMediaResolver подключает хранилище медиа для отправки файлов по ключу
+func (t *TgBot) SetMediaResolver(r MediaResolver) {
+	t.media = r
+}
+
+func (t *TgBot) requestFile(src MediaSource) (tgbotapi.RequestFileData, error) {
+	switch {
+	case src.FileId != "":
+		return tgbotapi.FileID(src.FileId), nil
+	case src.Url != "":
+		return tgbotapi.FileURL(src.Url), nil
+	case src.Key != "":
+		if t.media == nil {
+			return nil, fmt.Errorf("хранилище медиа не настроено")
+		}
+		name, r, err := t.media.Open(src.Key)
+		if err != nil {
+			return nil, err
+		}
+		return tgbotapi.FileReader{Name: name, Reader: r}, nil
+	}
+	return nil, fmt.Errorf("не указан источник файла")
+}
+
+// DownloadFile скачивает присланный боту файл (тг отдает ботам файлы до 20мб)
+func (t *TgBot) DownloadFile(fileId string) (io.ReadCloser, error) {
+	url, err := t.bot.GetFileDirectURL(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ошибка скачивания файла: %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// SendMedia отправляет одно вложение с подписью, возвращает id сообщения
+func (t *TgBot) SendMedia(chatId int64, kind c.MediaKind, src MediaSource, caption string, kb Markup, opts SendOptions) (int, error) {
+	method, ok := mediaMethods[kind]
+	if !ok {
+		return 0, fmt.Errorf("отправка вложений типа %s не поддерживается", kind)
+	}
+
+	var markup interface{}
+	if kb != nil {
+		m, err := kb.render(t, chatId)
+		if err != nil {
+			return 0, err
+		}
+		markup = m
+	}
+
+	params, err := chatParams(chatId, markup, opts)
+	if err != nil {
+		return 0, err
+	}
+	params.AddNonEmpty("caption", caption)
+
+	data, err := t.requestFile(src)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := t.bot.UploadFiles(method.endpoint, params, []tgbotapi.RequestFile{{Name: method.field, Data: data}})
+	if err != nil {
+		return 0, err
+	}
+
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &msg); err != nil {
+		return 0, err
+	}
+
+	return msg.MessageID, nil
+}
+
+// albumMedia элемент поля media запроса sendMediaGroup
+type albumMedia struct {
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// SendAlbum отправляет от 2 до 10 вложений одним сообщением, возвращает id сообщений альбома
+func (t *TgBot) SendAlbum(chatId int64, items []MediaItem, opts SendOptions) ([]int, error) {
+	if len(items) < 2 || len(items) > 10 {
+		return nil, fmt.Errorf("в альбоме может быть от 2 до 10 вложений")
+	}
+
+	params, err := chatParams(chatId, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	// у альбома parse_mode задается на каждом элементе
+	mode := params["parse_mode"]
+	delete(params, "parse_mode")
+
+	media := make([]albumMedia, 0, len(items))
+	files := make([]tgbotapi.RequestFile, 0)
+	for i, item := range items {
+		if !albumKinds[item.Kind] {
+			closeFiles(files)
+			return nil, fmt.Errorf("вложение типа %s нельзя отправить в альбоме", item.Kind)
+		}
+
+		data, err := t.requestFile(item.Source)
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+
+		m := albumMedia{Type: string(item.Kind), Caption: item.Caption}
+		if item.Caption != "" {
+			m.ParseMode = mode
+		}
+		if data.NeedsUpload() {
+			name := fmt.Sprintf("file-%d", i)
+			m.Media = "attach://" + name
+			files = append(files, tgbotapi.RequestFile{Name: name, Data: data})
+		} else {
+			m.Media = data.SendData()
+		}
+		media = append(media, m)
+	}
+
+	if err := params.AddInterface("media", media); err != nil {
+		closeFiles(files)
+		return nil, err
+	}
+
+	resp, err := t.bot.UploadFiles("sendMediaGroup", params, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &msgs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.MessageID)
+	}
+
+	return ids, nil
+}
+
+// closeFiles закрывает открытые из хранилища файлы если до отправки дело не дошло
+func closeFiles(files []tgbotapi.RequestFile) {
+	for _, f := range files {
+		if fr, ok := f.Data.(tgbotapi.FileReader); ok {
+			if closer, ok := fr.Reader.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	c "github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type fakeResolver map[string]string
+
+func (f fakeResolver) Open(key string) (string, io.ReadCloser, error) {
+	return key + ".jpg", io.NopCloser(strings.NewReader(f[key])), nil
+}
+
+func TestRequestFile(t *testing.T) {
+	bot := &TgBot{}
+
+	data, err := bot.requestFile(MediaSource{Url: "https://example.com/a.jpg"})
+	if err != nil || data.NeedsUpload() || data.SendData() != "https://example.com/a.jpg" {
+		t.Fatalf("url source: %v %v", data, err)
+	}
+
+	if _, err := bot.requestFile(MediaSource{Key: "abc"}); err == nil {
+		t.Error("key without media store should fail")
+	}
+
+	bot.SetMediaResolver(fakeResolver{"abc": "bytes"})
+	data, err = bot.requestFile(MediaSource{Key: "abc"})
+	if err != nil || !data.NeedsUpload() {
+		t.Fatalf("key source: %v %v", data, err)
+	}
+	if fr := data.(tgbotapi.FileReader); fr.Name != "abc.jpg" {
+		t.Errorf("unexpected file name %s", fr.Name)
+	}
+
+	if _, err := bot.requestFile(MediaSource{}); err == nil {
+		t.Error("empty source should fail")
+	}
+}
+
+func TestSendAlbumValidation(t *testing.T) {
+	bot := &TgBot{}
+	photo := MediaItem{Kind: c.MediaKind_Photo, Source: MediaSource{FileId: "x"}}
+
+	if _, err := bot.SendAlbum(1, []MediaItem{photo}, SendOptions{}); err == nil {
+		t.Error("single item album should fail")
+	}
+
+	voice := MediaItem{Kind: c.MediaKind_Voice, Source: MediaSource{FileId: "y"}}
+	if _, err := bot.SendAlbum(1, []MediaItem{photo, voice}, SendOptions{}); err == nil {
+		t.Error("voice is not allowed in album")
+	}
+
+	if _, err := bot.SendMedia(1, c.MediaKind_Sticker, MediaSource{FileId: "z"}, "", nil, SendOptions{}); err == nil {
+		t.Error("unsupported kind should fail")
+	}
+}
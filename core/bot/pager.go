@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	CbNamespace_Page = "pg"
+	// рядов на странице по умолчанию
+	DefaultPageSize = 10
+
+	pageKeyPrefix  = "pg:"
+	pageActionNav  = "nav"
+	pageActionNoop = "noop"
+)
+
+// pageState клавиатура целиком, хранится в кэше пока живут кнопки
+type pageState struct {
+	Rows [][]MeshInlineButton `json:"rows"`
+	Size int                  `json:"size"`
+}
+
+// paginate сохраняет клавиатуру на сервере и возвращает первую страницу
+func (t *TgBot) paginate(mesh MeshInlineKeyboard, size int) (MeshInlineKeyboard, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return mesh, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(buf)
+
+	state := pageState{Rows: mesh.Rows, Size: size}
+	body, err := json.Marshal(state)
+	if err != nil {
+		return mesh, err
+	}
+
+	if err := t.callbacks.store.SetStringTTL(pageKeyPrefix+id, string(body), t.callbacks.ttl); err != nil {
+		return mesh, err
+	}
+
+	return renderPage(id, state, 0), nil
+}
+
+// renderPage ряды страницы и навигация
+func renderPage(id string, state pageState, page int) MeshInlineKeyboard {
+	pages := (len(state.Rows) + state.Size - 1) / state.Size
+	if page < 0 || page >= pages {
+		page = 0
+	}
+
+	start := page * state.Size
+	end := min(start+state.Size, len(state.Rows))
+
+	result := MeshInlineKeyboard{Rows: append([][]MeshInlineButton{}, state.Rows[start:end]...)}
+
+	nav := make([]MeshInlineButton, 0, 3)
+	if page > 0 {
+		nav = append(nav, pageButton("◀", pageActionNav, fmt.Sprintf("%s:%d", id, page-1)))
+	}
+	nav = append(nav, pageButton(fmt.Sprintf("%d/%d", page+1, pages), pageActionNoop, ""))
+	if page < pages-1 {
+		nav = append(nav, pageButton("▶", pageActionNav, fmt.Sprintf("%s:%d", id, page+1)))
+	}
+	result.Rows = append(result.Rows, nav)
+
+	return result
+}
+
+func pageButton(text, action, data string) MeshInlineButton {
+	return MeshInlineButton{Text: text, Script: NamespacedScript(CbNamespace_Page, action), CustomCbData: data}
+}
+
+// HandlePageCallback листание страниц, сообщение редактируется на месте
+func (t *TgBot) HandlePageCallback(query *tgbotapi.CallbackQuery, action, data string) error {
+	if action != pageActionNav || query.Message == nil {
+		return nil
+	}
+
+	id, rawPage, ok := strings.Cut(data, ":")
+	if !ok {
+		return fmt.Errorf("некорректные данные листания %s", data)
+	}
+	page, err := strconv.Atoi(rawPage)
+	if err != nil {
+		return err
+	}
+
+	body := t.callbacks.store.GetString(pageKeyPrefix + id)
+	if body == "" {
+		return fmt.Errorf("страницы устарели")
+	}
+
+	var state pageState
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		return err
+	}
+
+	edit := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID,
+		t.InlineKeyboard(renderPage(id, state, page)))
+	_, err = t.bot.Request(edit)
+	return err
+}
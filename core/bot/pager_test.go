@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/cache"
+)
+
+func TestPaginate(t *testing.T) {
+	store := cache.NewInMemoryCache(time.Minute)
+	defer store.Stop()
+	bot := &TgBot{callbacks: NewCallbackRegistry(store, time.Minute, "secret")}
+
+	var mesh MeshInlineKeyboard
+	for i := 0; i < 7; i++ {
+		mesh.Rows = append(mesh.Rows, []MeshInlineButton{{Text: fmt.Sprint(i), Script: "order"}})
+	}
+
+	first, err := bot.paginate(mesh, 3)
+	if err != nil {
+		t.Fatalf("paginate failed: %v", err)
+	}
+
+	// 3 ряда + навигация
+	if len(first.Rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(first.Rows))
+	}
+	nav := first.Rows[3]
+	if len(nav) != 2 || nav[0].Text != "1/3" || nav[1].Script != "pg:nav" {
+		t.Fatalf("unexpected nav row %+v", nav)
+	}
+
+	id := nav[1].CustomCbData[:len(nav[1].CustomCbData)-2]
+	if store.GetString(pageKeyPrefix+id) == "" {
+		t.Fatal("page state was not stored")
+	}
+
+	// данные кнопки листания влезают в лимит тг без токена
+	raw, err := bot.callbacks.Encode(nav[1].cbData())
+	if err != nil || len(raw) > callbackDataLimit || raw[:1] != cbPrefixInline {
+		t.Errorf("nav button should be inline encoded, got %q %v", raw, err)
+	}
+
+	state := pageState{Rows: mesh.Rows, Size: 3}
+	last := renderPage(id, state, 2)
+	if len(last.Rows) != 2 || last.Rows[0][0].Text != "6" {
+		t.Fatalf("unexpected last page %+v", last.Rows)
+	}
+	if nav := last.Rows[1]; len(nav) != 2 || nav[0].Text != "◀" || nav[1].Text != "3/3" {
+		t.Errorf("unexpected last nav %+v", nav)
+	}
+}
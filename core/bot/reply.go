@@ -0,0 +1,224 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	c "github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// reply клавиатура висит у пользователя пока ее не заменят или не уберут
+	replyRoutesTTL     = 30 * 24 * time.Hour
+	replyKeyPrefix     = "rk:"
+	replyRouteContact  = "\x00contact"
+	replyRouteLocation = "\x00location"
+)
+
+// Markup клавиатура которую можно приложить к сообщению: MeshInlineKeyboard или MeshReplyKeyboard
+type Markup interface {
+	render(t *TgBot, chatId int64) (interface{}, error)
+}
+
+func (m MeshInlineKeyboard) render(t *TgBot, _ int64) (interface{}, error) {
+	return t.markup(m)
+}
+
+// MeshReplyKeyboard обычная клавиатура под полем ввода, нажатие приходит текстом кнопки
+type MeshReplyKeyboard struct {
+	Rows        [][]MeshReplyButton
+	Resize      bool
+	OneTime     bool
+	Placeholder string
+	// убрать клавиатуру, ряды игнорируются
+	Remove bool
+}
+
+type MeshReplyButton struct {
+	Text            string
+	Script          string
+	CustomCbData    string
+	Roles           []string
+	RequestContact  bool
+	RequestLocation bool
+}
+
+// render запоминает скрипты кнопок для чата, по ним потом маршрутизируются нажатия
+func (m MeshReplyKeyboard) render(t *TgBot, chatId int64) (interface{}, error) {
+	if m.Remove {
+		return tgbotapi.NewRemoveKeyboard(true), t.callbacks.store.Delete(replyRoutesKey(chatId))
+	}
+
+	routes := make(map[string]CbData)
+	keyboard := make([][]tgbotapi.KeyboardButton, 0, len(m.Rows))
+	for _, meshRow := range m.Rows {
+		row := make([]tgbotapi.KeyboardButton, 0, len(meshRow))
+		for _, b := range meshRow {
+			btn := tgbotapi.NewKeyboardButton(b.Text)
+			route := b.Text
+			switch {
+			case b.RequestContact:
+				btn.RequestContact = true
+				route = replyRouteContact
+			case b.RequestLocation:
+				btn.RequestLocation = true
+				route = replyRouteLocation
+			}
+			row = append(row, btn)
+
+			if b.Script != "" {
+				script, data := b.Script, b.CustomCbData
+				routes[route] = CbData{Script: &script, Data: &data, Roles: b.Roles}
+			}
+		}
+		keyboard = append(keyboard, row)
+	}
+
+	// новая клавиатура заменяет старую вместе с ее кнопками
+	if err := t.saveReplyRoutes(chatId, routes); err != nil {
+		return nil, err
+	}
+
+	markup := tgbotapi.NewReplyKeyboard(keyboard...)
+	markup.ResizeKeyboard = m.Resize
+	markup.OneTimeKeyboard = m.OneTime
+	markup.InputFieldPlaceholder = m.Placeholder
+
+	return markup, nil
+}
+
+func replyRoutesKey(chatId int64) string {
+	return fmt.Sprintf("%s%d", replyKeyPrefix, chatId)
+}
+
+func (t *TgBot) saveReplyRoutes(chatId int64, routes map[string]CbData) error {
+	if len(routes) == 0 {
+		return t.callbacks.store.Delete(replyRoutesKey(chatId))
+	}
+
+	body, err := json.Marshal(routes)
+	if err != nil {
+		return err
+	}
+
+	return t.callbacks.store.SetStringTTL(replyRoutesKey(chatId), string(body), replyRoutesTTL)
+}
+
+// ResolveReplyButton ищет кнопку reply клавиатуры чата по тексту сообщения (или контакту/геопозиции)
+func (t *TgBot) ResolveReplyButton(msg *tgbotapi.Message) (CbData, bool) {
+	var route string
+	switch {
+	case msg.Contact != nil:
+		route = replyRouteContact
+	case msg.Location != nil:
+		route = replyRouteLocation
+	case msg.Text != "":
+		route = msg.Text
+	default:
+		return CbData{}, false
+	}
+
+	body := t.callbacks.store.GetString(replyRoutesKey(msg.Chat.ID))
+	if body == "" {
+		return CbData{}, false
+	}
+
+	var routes map[string]CbData
+	if err := json.Unmarshal([]byte(body), &routes); err != nil {
+		return CbData{}, false
+	}
+
+	d, ok := routes[route]
+	return d, ok
+}
+
+// ParseKeyboard клавиатура из конфига нужного типа
+func ParseKeyboard(kb *c.Keyboard) Markup {
+	if kb.IsReply() {
+		return ParseReplyKeyboard(kb)
+	}
+	return ParseInlineKeyboard(kb)
+}
+
+// ParseReplyKeyboard функция для конвертации конфига в MeshReplyKeyboard
+func ParseReplyKeyboard(kb *c.Keyboard) MeshReplyKeyboard {
+	mesh := MeshReplyKeyboard{Resize: kb.Resize, OneTime: kb.OneTime}
+	if kb.Placeholder != nil {
+		mesh.Placeholder = *kb.Placeholder
+	}
+
+	for _, r := range *kb.Buttons {
+		row := make([]MeshReplyButton, 0, len(r.Row))
+		for _, b := range r.Row {
+			btn := MeshReplyButton{Text: b.Text, Roles: b.Roles, RequestContact: b.RequestContact, RequestLocation: b.RequestLocation}
+			if b.Script != nil {
+				btn.Script = *b.Script
+			}
+			if b.Data != nil {
+				btn.CustomCbData = *b.Data
+			}
+			row = append(row, btn)
+		}
+		mesh.Rows = append(mesh.Rows, row)
+	}
+
+	return mesh
+}
+
+// FromLuaTableToMarkup клавиатура из луа таблицы, Type = "reply" или Remove = true - reply клавиатура
+func FromLuaTableToMarkup(lt *lua.LTable) Markup {
+	if lt.RawGetString("Type").String() == string(c.KeyboardType_Reply) || lua.LVAsBool(lt.RawGetString("Remove")) {
+		return FromLuaTableToMeshReplyKeyboard(lt)
+	}
+	return FromLuaTableToMeshInlineKeyboard(lt)
+}
+
+// функция для конвертации Lua таблицы в MeshReplyKeyboard
+func FromLuaTableToMeshReplyKeyboard(lt *lua.LTable) MeshReplyKeyboard {
+	mesh := MeshReplyKeyboard{
+		Resize:      lua.LVAsBool(lt.RawGetString("Resize")),
+		OneTime:     lua.LVAsBool(lt.RawGetString("OneTime")),
+		Placeholder: lua.LVAsString(lt.RawGetString("Placeholder")),
+		Remove:      lua.LVAsBool(lt.RawGetString("Remove")),
+	}
+
+	rows, ok := lt.RawGetString("Rows").(*lua.LTable)
+	if !ok {
+		return mesh
+	}
+
+	rows.ForEach(func(_ lua.LValue, rowValue lua.LValue) {
+		row, ok := rowValue.(*lua.LTable)
+		if !ok {
+			return
+		}
+
+		var meshRow []MeshReplyButton
+		row.ForEach(func(_ lua.LValue, btnValue lua.LValue) {
+			btn, ok := btnValue.(*lua.LTable)
+			if !ok {
+				return
+			}
+
+			meshBtn := MeshReplyButton{
+				Text:            lua.LVAsString(btn.RawGetString("Text")),
+				Script:          lua.LVAsString(btn.RawGetString("Script")),
+				CustomCbData:    lua.LVAsString(btn.RawGetString("Data")),
+				RequestContact:  lua.LVAsBool(btn.RawGetString("RequestContact")),
+				RequestLocation: lua.LVAsBool(btn.RawGetString("RequestLocation")),
+			}
+			if roles, ok := btn.RawGetString("Roles").(*lua.LTable); ok {
+				roles.ForEach(func(_ lua.LValue, role lua.LValue) {
+					meshBtn.Roles = append(meshBtn.Roles, role.String())
+				})
+			}
+			meshRow = append(meshRow, meshBtn)
+		})
+		mesh.Rows = append(mesh.Rows, meshRow)
+	})
+
+	return mesh
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/cache"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestReplyRoutes(t *testing.T) {
+	store := cache.NewInMemoryCache(time.Minute)
+	defer store.Stop()
+	bot := &TgBot{callbacks: NewCallbackRegistry(store, time.Minute, "secret")}
+
+	mesh := MeshReplyKeyboard{
+		Resize: true,
+		Rows: [][]MeshReplyButton{
+			{{Text: "Каталог", Script: "catalog", CustomCbData: "1"}, {Text: "Просто текст"}},
+			{{Text: "Телефон", Script: "phone", RequestContact: true}},
+		},
+	}
+
+	raw, err := mesh.render(bot, 5)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	markup, ok := raw.(tgbotapi.ReplyKeyboardMarkup)
+	if !ok || !markup.ResizeKeyboard || !markup.Keyboard[1][0].RequestContact {
+		t.Fatalf("unexpected markup %+v", raw)
+	}
+
+	chat := &tgbotapi.Chat{ID: 5}
+
+	d, ok := bot.ResolveReplyButton(&tgbotapi.Message{Chat: chat, Text: "Каталог"})
+	if !ok || *d.Script != "catalog" || *d.Data != "1" {
+		t.Fatalf("text press not routed: %+v", d)
+	}
+
+	if _, ok := bot.ResolveReplyButton(&tgbotapi.Message{Chat: chat, Text: "Просто текст"}); ok {
+		t.Error("button without script should not be routed")
+	}
+
+	d, ok = bot.ResolveReplyButton(&tgbotapi.Message{Chat: chat, Contact: &tgbotapi.Contact{PhoneNumber: "+7"}})
+	if !ok || *d.Script != "phone" {
+		t.Fatalf("contact not routed: %+v", d)
+	}
+
+	// кнопки другого чата не видны
+	if _, ok := bot.ResolveReplyButton(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 6}, Text: "Каталог"}); ok {
+		t.Error("routes leaked to another chat")
+	}
+
+	// после удаления клавиатуры нажатия не маршрутизируются
+	if _, err := (MeshReplyKeyboard{Remove: true}).render(bot, 5); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, ok := bot.ResolveReplyButton(&tgbotapi.Message{Chat: chat, Text: "Каталог"}); ok {
+		t.Error("routes should be cleared after remove")
+	}
+}
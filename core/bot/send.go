@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SendOptions дополнительные параметры отправки сообщения
+type SendOptions struct {
+	// markdown, markdownv2 или html, регистр не важен
+	ParseMode string
+	// id сообщения на которое отвечаем
+	ReplyTo int
+	// без звука уведомления
+	Silent bool
+	// запрет пересылки и сохранения
+	Protect bool
+	// без превью ссылок
+	NoPreview bool
+	// id темы в форум группе
+	ThreadId int
+}
+
+var parseModes = map[string]string{
+	"markdown":   tgbotapi.ModeMarkdown,
+	"markdownv2": tgbotapi.ModeMarkdownV2,
+	"html":       tgbotapi.ModeHTML,
+}
+
+// ParseMode приводит название режима разметки к виду тг
+func ParseMode(mode string) (string, error) {
+	if mode == "" {
+		return "", nil
+	}
+
+	if m, ok := parseModes[strings.ToLower(mode)]; ok {
+		return m, nil
+	}
+
+	return "", fmt.Errorf("неизвестный parse_mode %s", mode)
+}
+
+// SendOpts отправляет сообщение с опциями и необязательной клавиатурой (inline или reply), возвращает id сообщения
+// в используемой версии tgbotapi нет protect_content и message_thread_id, поэтому запрос собирается вручную
+func (t *TgBot) SendOpts(chatId int64, text string, kb Markup, opts SendOptions) (int, error) {
+	var markup interface{}
+	if kb != nil {
+		m, err := kb.render(t, chatId)
+		if err != nil {
+			return 0, err
+		}
+		markup = m
+	}
+
+	params, err := sendParams(chatId, text, markup, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := t.bot.MakeRequest("sendMessage", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &msg); err != nil {
+		return 0, err
+	}
+
+	return msg.MessageID, nil
+}
+
+func sendParams(chatId int64, text string, markup interface{}, opts SendOptions) (tgbotapi.Params, error) {
+	params, err := chatParams(chatId, markup, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	params.AddNonEmpty("text", text)
+	params.AddBool("disable_web_page_preview", opts.NoPreview)
+
+	return params, nil
+}
+
+// chatParams общие параметры отправки любых сообщений
+func chatParams(chatId int64, markup interface{}, opts SendOptions) (tgbotapi.Params, error) {
+	mode, err := ParseMode(opts.ParseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", chatId)
+	params.AddNonEmpty("parse_mode", mode)
+	params.AddNonZero("reply_to_message_id", opts.ReplyTo)
+	// если исходное сообщение удалили - все равно отправляем
+	params.AddBool("allow_sending_without_reply", opts.ReplyTo != 0)
+	params.AddBool("disable_notification", opts.Silent)
+	params.AddBool("protect_content", opts.Protect)
+	params.AddNonZero("message_thread_id", opts.ThreadId)
+
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
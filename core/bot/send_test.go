@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"html", tgbotapi.ModeHTML, false},
+		{"MarkdownV2", tgbotapi.ModeMarkdownV2, false},
+		{"markdown", tgbotapi.ModeMarkdown, false},
+		{"bbcode", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSendParams(t *testing.T) {
+	params, err := sendParams(-100, "hi", nil, SendOptions{
+		ParseMode: "html",
+		ReplyTo:   7,
+		Silent:    true,
+		Protect:   true,
+		NoPreview: true,
+		ThreadId:  3,
+	})
+	if err != nil {
+		t.Fatalf("sendParams failed: %v", err)
+	}
+
+	want := map[string]string{
+		"chat_id":                     "-100",
+		"text":                        "hi",
+		"parse_mode":                  "HTML",
+		"reply_to_message_id":         "7",
+		"allow_sending_without_reply": "true",
+		"disable_notification":        "true",
+		"protect_content":             "true",
+		"disable_web_page_preview":    "true",
+		"message_thread_id":           "3",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("param %s = %q, want %q", k, params[k], v)
+		}
+	}
+	if _, ok := params["reply_markup"]; ok {
+		t.Error("reply_markup should be omitted without keyboard")
+	}
+
+	// без опций лишних полей нет
+	params, err = sendParams(1, "hi", nil, SendOptions{})
+	if err != nil {
+		t.Fatalf("sendParams failed: %v", err)
+	}
+	if len(params) != 2 {
+		t.Errorf("expected only chat_id and text, got %v", params)
+	}
+
+	if _, err := sendParams(1, "hi", nil, SendOptions{ParseMode: "xml"}); err == nil {
+		t.Error("expected error for unknown parse mode")
+	}
+}
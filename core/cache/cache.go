@@ -1,7 +1,12 @@
 package cache
 
+import "time"
+
 type Cache interface {
 	GetString(key string) string
 	SetString(key string, val string) error
+	// SetStringTTL запись со своим временем жизни
+	SetStringTTL(key string, val string, ttl time.Duration) error
 	Exists(key string) bool
+	Delete(key string) error
 }
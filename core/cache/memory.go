@@ -59,12 +59,16 @@ func (c *InMemoryCache) GetString(key string) string {
 }
 
 func (c *InMemoryCache) SetString(key string, val string) error {
+	return c.SetStringTTL(key, val, c.ttl)
+}
+
+func (c *InMemoryCache) SetStringTTL(key string, val string, ttl time.Duration) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.data[key] = cacheEntry{
 		value:     val,
-		expiresAt: time.Now().Add(c.ttl),
+		expiresAt: time.Now().Add(ttl),
 	}
 
 	return nil
@@ -79,6 +83,14 @@ func (c *InMemoryCache) Exists(key string) bool {
 	return exists && val.value != ""
 }
 
+func (c *InMemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.data, key)
+	return nil
+}
+
 func (c *InMemoryCache) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -48,10 +48,14 @@ func (c *RedisCache) GetString(key string) string {
 }
 
 func (c *RedisCache) SetString(key string, val string) error {
+	return c.SetStringTTL(key, val, defaultExpiration)
+}
+
+func (c *RedisCache) SetStringTTL(key string, val string, ttl time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return c.client.Set(ctx, key, val, defaultExpiration).Err()
+	return c.client.Set(ctx, key, val, ttl).Err()
 }
 
 func (c *RedisCache) Exists(key string) bool {
@@ -61,3 +65,10 @@ func (c *RedisCache) Exists(key string) bool {
 	val, err := c.client.Get(ctx, key).Result()
 	return err == nil && val != ""
 }
+
+func (c *RedisCache) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return c.client.Del(ctx, key).Err()
+}
@@ -12,7 +12,10 @@ import (
 	ca "github.com/end1essrage/indigo-core/cache"
 	"github.com/end1essrage/indigo-core/client"
 	c "github.com/end1essrage/indigo-core/config"
+	h "github.com/end1essrage/indigo-core/handler"
 	l "github.com/end1essrage/indigo-core/lua"
+	"github.com/end1essrage/indigo-core/media"
+	"github.com/end1essrage/indigo-core/receiver"
 	"github.com/end1essrage/indigo-core/secret"
 	s "github.com/end1essrage/indigo-core/server"
 	"github.com/end1essrage/indigo-core/service"
@@ -97,12 +100,6 @@ func main() {
 	tBot.Debug = config.Bot.Debug
 	logrus.Infof("Authorized on account %s", tBot.Self.UserName)
 
-	//обертка над тг ботом
-	bot := b.NewBot(tBot)
-
-	//buffer
-	buffer := ca.NewInMemoryCache(5 * time.Minute)
-
 	//кэш
 	var cache ca.Cache
 	switch config.Cache.Type {
@@ -113,11 +110,14 @@ func main() {
 		}
 		cache = redis
 	case c.Cache_Memory:
-		cache = buffer
+		cache = ca.NewInMemoryCache(5 * time.Minute)
 	default:
 		panic(fmt.Errorf("Not implemented"))
 	}
 
+	//обертка над тг ботом, данные кнопок не влезающие в лимит тг хранятся в кэше, короткие подписываются токеном бота
+	bot := b.NewBot(tBot, b.NewCallbackRegistry(cache, b.DefaultCallbackTTL, Token))
+
 	//хранилище
 	var storage storage.Storage
 	switch config.Storage.Type {
@@ -137,35 +137,102 @@ func main() {
 		panic(fmt.Errorf("Not implemented"))
 	}
 
+	//хранилище медиа, файлы из него можно отправлять по ключу
+	mediaStore, err := media.NewStore(config.Media)
+	if err != nil {
+		logrus.Fatalf("Error creating media store: %v", err)
+	}
+	if mediaStore != nil {
+		bot.SetMediaResolver(mediaStore)
+	}
+
 	//http клиент
 	client := client.NewHttpClient()
 
 	//сервисы
-	service := service.NewService(bot, storage, cache)
+	service := service.NewService(bot, storage, cache, config)
+
+	// если админов нет - первый получает права через /adm <токен>
+	if ok, err := service.HasAdmins(); err != nil {
+		logrus.Errorf("ошибка проверки админов: %v", err)
+	} else if !ok {
+		var token string
+		if config.Bot.ClaimSecret != nil {
+			token = sec.RevealSecret(*config.Bot.ClaimSecret)
+		}
+		generated := token == ""
+		token, err = service.SetClaimToken(token)
+		if err != nil {
+			logrus.Fatalf("Error generating admin token: %v", err)
+		}
+		if generated {
+			logrus.Warnf("админы не назначены, отправьте боту в личке: /adm %s", token)
+		} else {
+			logrus.Warn("админы не назначены, отправьте боту в личке /adm <токен из секрета>")
+		}
+	}
+
+	//прогресс форм, в кэше (с redis переживает перезапуск) или в хранилище
+	sessionTTL := config.Sessions.TTLDuration()
+	if sessionTTL == 0 {
+		sessionTTL = h.DefaultSessionTTL
+	}
+	var sessions h.SessionStore
+	switch config.Sessions.Type {
+	case c.Session_Storage:
+		sessions = h.NewStorageSessions(storage, sessionTTL)
+	default:
+		sessions = h.NewCacheSessions(cache, sessionTTL)
+	}
+
+	//состояния диалогов из луа, живут столько же сколько формы
+	states := h.NewStateStore(cache, sessionTTL)
 
 	//луа движок
-	le := l.NewLuaEngine(bot, cache, client, storage, ScriptsPath, sec, service)
+	le := l.NewLuaEngine(bot, cache, client, storage, ScriptsPath, sec, service, mediaStore, states)
 
 	//обрабатывающий сервер
-	server := s.NewServer(le, bot, config, buffer, service)
+	configPath := path.Join(curDir, ConfigPath)
+	server := s.NewServer(le, bot, config, configPath, sessions, states, service, mediaStore)
 
 	//получаем обновления
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := tBot.GetUpdatesChan(u)
+	var rec receiver.Receiver
+	switch config.Bot.Mode {
+	case c.BotMode_Webhook:
+		var secretToken string
+		if config.Bot.Webhook.Secret != nil {
+			secretToken = sec.RevealSecret(*config.Bot.Webhook.Secret)
+		}
+		rec = receiver.NewWebhook(tBot, config.Bot.Webhook, secretToken)
+	default:
+		rec = receiver.NewPolling(tBot)
+	}
 
 	logrus.Info("start processing")
 	// обработка обновлений
-	server.Start(updates)
+	if err := server.Start(rec); err != nil {
+		logrus.Fatalf("Error starting receiver: %v", err)
+	}
+
+	// перезагрузка конфига и скриптов: по изменению файлов и по SIGHUP
+	if config.Reload.Watch {
+		server.Watch(config.Reload.IntervalDuration())
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := server.Reload(); err != nil {
+				logrus.Errorf("ошибка перезагрузки: %v", err)
+			}
+		}
+	}()
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	tBot.StopReceivingUpdates()
-
 	server.Stop()
 
 	logrus.Info("Server stopped")
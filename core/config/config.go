@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	yaml "github.com/goccy/go-yaml"
 )
@@ -12,13 +13,18 @@ type YamlConfig struct {
 	Cache        CacheConfig    `yaml:"cache"`
 	Storage      StorageConfig  `yaml:"storage"`
 	Media        MediaConfig    `yaml:"media"`
+	Sessions     SessionConfig  `yaml:"sessions,omitempty"`
+	Reload       ReloadConfig   `yaml:"reload,omitempty"`
 	Api          *ApiConfig     `yaml:"api,omitempty"`
 	Commands     []Command      `yaml:"commands"`
 	Keyboards    []Keyboard     `yaml:"keyboards,omitempty"`
 	Forms        []Form         `yaml:"forms,omitempty"`
+	States       []State        `yaml:"states,omitempty"`
 	Interceptors []Interceptor  `yaml:"interceptors,omitempty"`
 	Modules      []ModuleConfig `yaml:"modules,omitempty"`
 	Secrets      []Secret       `yaml:"secrets,omitempty"`
+	Roles        []Role         `yaml:"roles,omitempty"`
+	Admin        AdminConfig    `yaml:"admin,omitempty"`
 }
 
 type Config struct {
@@ -26,13 +32,18 @@ type Config struct {
 	HTTP         *ApiConfig
 	Cache        CacheConfig
 	Storage      StorageConfig
+	Sessions     SessionConfig
+	Reload       ReloadConfig
 	Commands     map[string]*Command
 	Keyboards    map[string]*Keyboard
 	Forms        map[string]*Form
+	States       map[string]*State
 	Interceptors []Interceptor
 	Modules      []ModuleConfig
 	Secrets      []Secret
 	Media        MediaConfig
+	Roles        map[string]*Role
+	Admin        AdminConfig
 }
 
 type ValidationErr error
@@ -61,10 +72,13 @@ func LoadConfig(path string, validate bool) (*Config, error) {
 	config.HTTP = yConfig.Api
 	config.Storage = yConfig.Storage
 	config.Cache = yConfig.Cache
+	config.Sessions = yConfig.Sessions
+	config.Reload = yConfig.Reload
 	config.Interceptors = yConfig.Interceptors
 	config.Modules = yConfig.Modules
 	config.Secrets = yConfig.Secrets
 	config.Media = yConfig.Media
+	config.Admin = yConfig.Admin
 
 	//fill commands
 	config.Commands = make(map[string]*Command)
@@ -78,18 +92,52 @@ func LoadConfig(path string, validate bool) (*Config, error) {
 		config.Keyboards[k.Name] = &k
 	}
 
+	//fill roles
+	config.Roles = make(map[string]*Role)
+	for _, r := range yConfig.Roles {
+		config.Roles[r.Name] = &r
+	}
+
 	//fill forms
 	config.Forms = make(map[string]*Form)
 	for _, f := range yConfig.Forms {
 		config.Forms[f.Name] = &f
 	}
 
+	//fill states
+	config.States = make(map[string]*State)
+	for _, st := range yConfig.States {
+		config.States[st.Name] = &st
+	}
+
 	return &config, nil
 }
 
 // MEDIA
 type MediaConfig struct {
-	Type string `yaml:"type"`
+	// local, пусто - файлы не сохраняются
+	Type  string `yaml:"type"`
+	Local *struct {
+		Path string `yaml:"path"`
+		// адрес по которому веб сервер раздает папку files, нужен для media_get_url
+		BaseUrl string `yaml:"base_url,omitempty"`
+	} `yaml:"local,omitempty"`
+	Handlers []MediaHandler `yaml:"handlers,omitempty"`
+}
+
+// MediaHandler скрипт на входящее вложение, срабатывает первый подходящий
+type MediaHandler struct {
+	// тип вложения, пусто - любое
+	Kind   MediaKind `yaml:"kind,omitempty"`
+	Script string    `yaml:"script"`
+	Roles  []string  `yaml:"roles,omitempty"`
+}
+
+// State обработчик состояния диалога: пока у пользователя задано состояние (state_set), его сообщения получает скрипт
+type State struct {
+	Name   string   `yaml:"name"`
+	Script string   `yaml:"script"`
+	Roles  []string `yaml:"roles,omitempty"`
 }
 
 // SECRETS
@@ -97,11 +145,67 @@ type Secret struct {
 	Name string `yaml:"name"`
 }
 
+// IsConfigAdmin админ объявленный в конфиге
+func (b BotConfig) IsConfigAdmin(userId int64) bool {
+	if userId == 0 {
+		return false
+	}
+	if userId == b.AdminId {
+		return true
+	}
+	for _, id := range b.Admins {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// ADMIN MENU
+type AdminConfig struct {
+	PageSize int           `yaml:"page_size,omitempty"`
+	Actions  []AdminAction `yaml:"actions,omitempty"`
+}
+
+// AdminAction пункт админ меню на луа
+type AdminAction struct {
+	Name   string `yaml:"name"`
+	Title  string `yaml:"title"`
+	Script string `yaml:"script"`
+}
+
+// ROLES
+type Role struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
 // BOT
 type BotConfig struct {
-	Mode    string `yaml:"mode"`
-	Debug   bool   `yaml:"debug"`
-	AdminId int64  `yaml:"admin"`
+	Mode  BotMode `yaml:"mode"`
+	Debug bool    `yaml:"debug"`
+	// устаревшее поле, для одного админа
+	AdminId int64   `yaml:"admin"`
+	Admins  []int64 `yaml:"admins,omitempty"`
+	// имя секрета с токеном для /adm <токен>, без него токен генерируется при старте
+	ClaimSecret *string        `yaml:"claim_secret,omitempty"`
+	Webhook     *WebhookConfig `yaml:"webhook,omitempty"`
+	// ответ при отсутствии нужной роли
+	AccessDenied *string `yaml:"access_denied,omitempty"`
+}
+
+// WebhookConfig настройки приема обновлений через вебхук
+type WebhookConfig struct {
+	// адрес листенера, например ":8443"
+	Address string `yaml:"address"`
+	// путь на котором слушаем обновления
+	Path string `yaml:"path"`
+	// публичный адрес (за балансировщиком) который регистрируем в тг, без пути
+	Url string `yaml:"url"`
+	// имя секрета со значением secret_token, зарегать в блоке секретов
+	Secret         *string `yaml:"secret,omitempty"`
+	MaxConnections int     `yaml:"max_connections,omitempty"`
+	DropPending    bool    `yaml:"drop_pending,omitempty"`
 }
 
 type Command struct {
@@ -111,14 +215,24 @@ type Command struct {
 	Reply       *string `yaml:"reply,omitempty"`
 	Keyboard    *string `yaml:"keyboard,omitempty"`
 	Form        *string `yaml:"form,omitempty"`
-	Use         CmdUse  `yaml:"use"`
+	Use         CmdUses `yaml:"use,omitempty"`
+	// роли которым доступна команда, пусто - всем
+	Roles []string `yaml:"roles,omitempty"`
+	// убрать reply клавиатуру, убирается вместе с ответом (reply)
+	RemoveKeyboard bool `yaml:"remove_keyboard,omitempty"`
 }
 
 type Button struct {
 	Text string `yaml:"text"`
 	//Event  *string
-	Data   *string `yaml:"data,omitempty"`
-	Script *string `yaml:"script,omitempty"`
+	Data   *string  `yaml:"data,omitempty"`
+	Script *string  `yaml:"script,omitempty"`
+	Roles  []string `yaml:"roles,omitempty"`
+	// переопределяет on_press клавиатуры
+	OnPress PressMode `yaml:"on_press,omitempty"`
+	// только для reply клавиатур: кнопка отправляет контакт или геопозицию
+	RequestContact  bool `yaml:"request_contact,omitempty"`
+	RequestLocation bool `yaml:"request_location,omitempty"`
 }
 
 type KeyboardRow struct {
@@ -127,8 +241,21 @@ type KeyboardRow struct {
 
 type Keyboard struct {
 	Name    string         `yaml:"name"`
+	Type    KeyboardType   `yaml:"type,omitempty"`
 	Message *string        `yaml:"message,omitempty"`
 	Buttons *[]KeyboardRow `yaml:"buttons,omitempty"`
+	// рядов на странице, если рядов больше - появляется листание
+	PageSize int       `yaml:"page_size,omitempty"`
+	OnPress  PressMode `yaml:"on_press,omitempty"`
+	// настройки reply клавиатуры
+	Resize      bool    `yaml:"resize,omitempty"`
+	OneTime     bool    `yaml:"one_time,omitempty"`
+	Placeholder *string `yaml:"placeholder,omitempty"`
+}
+
+// IsReply обычная клавиатура под полем ввода, нажатия приходят текстом
+func (k *Keyboard) IsReply() bool {
+	return k.Type == KeyboardType_Reply
 }
 
 // Api
@@ -163,17 +290,130 @@ type Form struct {
 	Description *string     `yaml:"description,omitempty"`
 	Stages      []FormStage `yaml:"stages"`
 	Script      string      `yaml:"script"`
+	Roles       []string    `yaml:"roles,omitempty"`
+
+	// выход из формы, /cancel работает всегда
+	Cancel *FormControl `yaml:"cancel,omitempty"`
+	// возврат на предыдущий этап
+	Back *FormControl `yaml:"back,omitempty"`
+	// пропуск необязательного этапа, /skip работает всегда
+	Skip *FormControl `yaml:"skip,omitempty"`
+	// скрипт после отмены, в ctx.form_data уже введенные поля
+	OnCancel *string `yaml:"on_cancel,omitempty"`
+
+	// форма сбрасывается если пользователь молчит дольше timeout ("10m", "1h")
+	Timeout        string  `yaml:"timeout,omitempty"`
+	TimeoutMessage *string `yaml:"timeout_message,omitempty"`
+	OnTimeout      *string `yaml:"on_timeout,omitempty"`
+
+	// попыток ввода на этапе до отмены формы, 0 - без ограничений (этап может задать свое)
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+}
+
+// FormControl слова и кнопка управления формой
+type FormControl struct {
+	// слова без учета регистра, например "отмена"
+	Words []string `yaml:"words,omitempty"`
+	// текст кнопки, добавляется к каждому этапу
+	Button string `yaml:"button,omitempty"`
+	// ответ пользователю (только cancel)
+	Message *string `yaml:"message,omitempty"`
+}
+
+// TimeoutDuration время бездействия до сброса формы, 0 - без таймаута
+func (f *Form) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(f.Timeout)
+	return d
 }
 
 type FormStage struct {
-	Field      string          `yaml:"field"`
-	Message    string          `yaml:"message"`
+	Field   string `yaml:"field"`
+	Message string `yaml:"message"`
+	// проверка текста: string/length, email, number/range, regex, phone, date, enum, lua
 	Validation *map[string]any `yaml:"validation,omitempty"`
 	Keyboard   *string         `yaml:"keyboard,omitempty"`
 	Script     *string         `yaml:"script,omitempty"`
+	// что ожидаем от пользователя, по умолчанию текст
+	Input FormInput `yaml:"input,omitempty"`
+	// текст при неподходящем вводе, по умолчанию сообщение проверки
+	Error *string `yaml:"error,omitempty"`
+	// попыток ввода до отмены формы, перекрывает max_attempts формы
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+
+	// photo/document: сохранить файл в хранилище медиа, в форму попадет ключ вместо file_id
+	Save bool `yaml:"save,omitempty"`
+	// photo/document: максимальный размер в байтах
+	MaxSize int `yaml:"max_size,omitempty"`
+	// document: допустимые mime типы
+	Mime []string `yaml:"mime,omitempty"`
+	// contact: только собственный контакт пользователя
+	OwnContact bool `yaml:"own_contact,omitempty"`
+	// choice: варианты и ограничения на количество выбранных (max_choices: 1 - выбор в одно нажатие)
+	Options    []FormOption `yaml:"options,omitempty"`
+	MinChoices int          `yaml:"min_choices,omitempty"`
+	MaxChoices int          `yaml:"max_choices,omitempty"`
+
+	// этап задается только если условие выполнено, иначе пропускается
+	When *FormCondition `yaml:"when,omitempty"`
+	// переходы после этапа, срабатывает первый подходящий, без подходящих - следующий по порядку
+	Next []FormJump `yaml:"next,omitempty"`
+	// этап можно пропустить, поле не попадет в ctx.form_data
+	Optional bool `yaml:"optional,omitempty"`
+}
+
+// FormCondition условие над уже введенными полями или луа выражение над ctx.form_data
+type FormCondition struct {
+	Field     string   `yaml:"field,omitempty"`
+	Equals    *string  `yaml:"equals,omitempty"`
+	NotEquals *string  `yaml:"not_equals,omitempty"`
+	In        []string `yaml:"in,omitempty"`
+	// поле заполнено, условие по умолчанию если оператор не указан
+	Filled *bool `yaml:"filled,omitempty"`
+
+	// например "tonumber(ctx.form_data.age) >= 18"
+	Lua string `yaml:"lua,omitempty"`
+}
+
+// FormJump переход на этап с полем goto (или end - завершить форму)
+type FormJump struct {
+	When *FormCondition `yaml:"when,omitempty"`
+	Goto string         `yaml:"goto"`
+}
+
+type FormOption struct {
+	Text  string `yaml:"text"`
+	Value string `yaml:"value"`
 }
 
 // DATA
+// SessionConfig где хранится прогресс форм
+type SessionConfig struct {
+	// cache (по умолчанию) - в кэше бота, с redis переживает перезапуск; storage - в хранилище
+	Type SessionType `yaml:"type,omitempty"`
+	// время жизни незавершенной формы ("24h")
+	TTL string `yaml:"ttl,omitempty"`
+}
+
+// TTLDuration время жизни сессии, 0 - не задано
+func (s SessionConfig) TTLDuration() time.Duration {
+	d, _ := time.ParseDuration(s.TTL)
+	return d
+}
+
+// ReloadConfig перезагрузка конфига и скриптов без перезапуска (еще SIGHUP и админ меню)
+type ReloadConfig struct {
+	// следить за изменением файлов
+	Watch bool `yaml:"watch,omitempty"`
+	// как часто проверять файлы ("2s")
+	Interval string `yaml:"interval,omitempty"`
+}
+
+// IntervalDuration период проверки файлов, 0 - не задано
+func (r ReloadConfig) IntervalDuration() time.Duration {
+	d, _ := time.ParseDuration(r.Interval)
+	return d
+}
+
 type CacheConfig struct {
 	Type  CacheType `yaml:"type"`
 	Redis *struct {
@@ -214,11 +454,35 @@ const TRACK_USER Module = "track_user"
 
 type Interceptor struct {
 	Affects AffectMode `yaml:"affects"`
-	Scripts []string   `yaml:"scripts,omitempty"`
-	Modules []string   `yaml:"modules,omitempty"`
+	// регулярка для режима regex (проверяется текст или подпись)
+	Pattern *string `yaml:"pattern,omitempty"`
+	// луа выражение для режима filter, например: ctx.user.id == 123
+	Filter  *string  `yaml:"filter,omitempty"`
+	Scripts []string `yaml:"scripts,omitempty"`
+	Modules []string `yaml:"modules,omitempty"`
 }
 
 type ModuleConfig struct {
 	Name Module            `yaml:"name"`
 	Cfg  map[string]string `yaml:"cfg"`
 }
+
+// Module возвращает настройки модуля по имени, nil если модуль не настраивали
+func (c *Config) Module(name Module) *ModuleConfig {
+	for i := range c.Modules {
+		if c.Modules[i].Name == name {
+			return &c.Modules[i]
+		}
+	}
+	return nil
+}
+
+// ModuleOption значение опции модуля или значение по умолчанию
+func (c *Config) ModuleOption(name Module, key, def string) string {
+	if m := c.Module(name); m != nil {
+		if v, ok := m.Cfg[key]; ok && v != "" {
+			return v
+		}
+	}
+	return def
+}
@@ -1,5 +1,13 @@
 package config
 
+// polling, webhook
+type BotMode string
+
+const (
+	BotMode_Polling BotMode = "polling"
+	BotMode_Webhook BotMode = "webhook"
+)
+
 // memory, redis
 type CacheType string
 
@@ -16,6 +24,63 @@ const (
 	Storage_Mongo StorageType = "mongo"
 )
 
+// cache, storage
+type SessionType string
+
+const (
+	Session_Cache   SessionType = "cache"
+	Session_Storage SessionType = "storage"
+)
+
+// inline, reply
+type KeyboardType string
+
+const (
+	KeyboardType_Inline KeyboardType = "inline"
+	KeyboardType_Reply  KeyboardType = "reply"
+)
+
+// тип вложения сообщения
+type MediaKind string
+
+const (
+	MediaKind_Photo     MediaKind = "photo"
+	MediaKind_Document  MediaKind = "document"
+	MediaKind_Audio     MediaKind = "audio"
+	MediaKind_Video     MediaKind = "video"
+	MediaKind_Voice     MediaKind = "voice"
+	MediaKind_VideoNote MediaKind = "video_note"
+	MediaKind_Animation MediaKind = "animation"
+	MediaKind_Sticker   MediaKind = "sticker"
+)
+
+// FormInput тип ввода на этапе формы
+type FormInput string
+
+const (
+	FormInput_Text     FormInput = "text"
+	FormInput_Photo    FormInput = "photo"
+	FormInput_Document FormInput = "document"
+	FormInput_Contact  FormInput = "contact"
+	FormInput_Location FormInput = "location"
+	FormInput_Choice   FormInput = "choice"
+)
+
+// FormEnd цель перехода next, завершающая форму
+const FormEnd = "end"
+
+// PressMode что делать с сообщением клавиатуры после нажатия кнопки
+type PressMode string
+
+const (
+	// сообщение удаляется (по умолчанию)
+	PressMode_Delete PressMode = "delete"
+	// сообщение и клавиатура остаются
+	PressMode_Keep PressMode = "keep"
+	// клавиатура убирается, скрипт может отредактировать сообщение по ctx.message_id
+	PressMode_Edit PressMode = "edit"
+)
+
 type CmdUse string
 
 const (
@@ -23,3 +88,44 @@ const (
 	CmdUse_Group   CmdUse = "group"
 	CmdUse_Channel CmdUse = "channel"
 )
+
+// CmdUses список типов чатов где доступна команда, пусто - везде
+type CmdUses []CmdUse
+
+// UnmarshalYAML принимает как одно значение (use: "private"), так и список (use: ["private", "group"])
+func (u *CmdUses) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		if single == "" {
+			*u = nil
+		} else {
+			*u = CmdUses{CmdUse(single)}
+		}
+		return nil
+	}
+
+	var list []CmdUse
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*u = list
+	return nil
+}
+
+// Allows разрешена ли команда в чате данного типа
+func (u CmdUses) Allows(use CmdUse) bool {
+	if len(u) == 0 {
+		return true
+	}
+	for _, v := range u {
+		if v == use {
+			return true
+		}
+	}
+	return false
+}
+
+// Has явно ли указан тип чата
+func (u CmdUses) Has(use CmdUse) bool {
+	return len(u) > 0 && u.Allows(use)
+}
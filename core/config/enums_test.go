@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+func TestCmdUsesYaml(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want CmdUses
+	}{
+		{name: "scalar", src: `use: "private"`, want: CmdUses{CmdUse_Private}},
+		{name: "list", src: `use: ["private", "group"]`, want: CmdUses{CmdUse_Private, CmdUse_Group}},
+		{name: "empty", src: `name: "start"`, want: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmd Command
+			if err := yaml.Unmarshal([]byte(tc.src), &cmd); err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if len(cmd.Use) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, cmd.Use)
+			}
+			for i := range tc.want {
+				if cmd.Use[i] != tc.want[i] {
+					t.Errorf("expected %v, got %v", tc.want, cmd.Use)
+				}
+			}
+		})
+	}
+
+	if !(CmdUses{}).Allows(CmdUse_Channel) {
+		t.Error("empty use should allow every chat type")
+	}
+	if (CmdUses{CmdUse_Private}).Allows(CmdUse_Group) {
+		t.Error("private command should not be allowed in groups")
+	}
+}
@@ -2,11 +2,20 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/end1essrage/indigo-core/validation"
 	"github.com/sirupsen/logrus"
+	"github.com/yuin/gopher-lua/parse"
 )
 
 func Validate(config *YamlConfig) (bool, string) {
+	if err := validateBot(&config.Bot, config.Secrets); err != nil {
+		return false, fmt.Sprintf("ошибка валидации Bot %v", err)
+	}
+
 	if err := validateStorage(&config.Storage); err != nil {
 		return false, fmt.Sprintf("ошибка валидации Storage %v", err)
 	}
@@ -17,6 +26,42 @@ func Validate(config *YamlConfig) (bool, string) {
 		}
 	}
 
+	if err := validateRoles(config); err != nil {
+		return false, fmt.Sprintf("ошибка валидации ролей %v", err)
+	}
+
+	if err := validateAdmin(&config.Admin); err != nil {
+		return false, fmt.Sprintf("ошибка валидации админ меню %v", err)
+	}
+
+	if err := validateMedia(&config.Media); err != nil {
+		return false, fmt.Sprintf("ошибка валидации медиа %v", err)
+	}
+
+	if err := validateSessions(&config.Sessions); err != nil {
+		return false, fmt.Sprintf("ошибка валидации сессий форм %v", err)
+	}
+
+	for _, f := range config.Forms {
+		if err := validateForm(&f, &config.Media); err != nil {
+			return false, fmt.Sprintf("ошибка валидации формы %s: %v", f.Name, err)
+		}
+	}
+
+	if err := validateReload(&config.Reload); err != nil {
+		return false, fmt.Sprintf("ошибка валидации перезагрузки %v", err)
+	}
+
+	if err := validateStates(config.States); err != nil {
+		return false, fmt.Sprintf("ошибка валидации состояний %v", err)
+	}
+
+	for i, inter := range config.Interceptors {
+		if err := validateInterceptor(&inter); err != nil {
+			return false, fmt.Sprintf("ошибка валидации перехватчика #%d (%s): %v", i, inter.Affects, err)
+		}
+	}
+
 	//параллельно?
 	for _, k := range config.Keyboards {
 		logrus.Debugf("Validating %s", k.Name)
@@ -32,15 +77,100 @@ func validateKeyboard(kb Keyboard) error {
 		return fmt.Errorf("пустая клавиатура")
 	}
 
-	//ограничения тг
-	if len(*kb.Buttons) > 10 {
-		return fmt.Errorf("слишком много рядов")
+	switch kb.Type {
+	case "", KeyboardType_Inline:
+	case KeyboardType_Reply:
+		return validateReplyKeyboard(kb)
+	default:
+		return fmt.Errorf("неизвестный тип клавиатуры %s", kb.Type)
+	}
+
+	//ограничения тг, длинные клавиатуры листаются по страницам
+	if kb.PageSize < 0 || kb.PageSize > 10 {
+		return fmt.Errorf("слишком много рядов на странице")
+	}
+
+	if err := validatePressMode(kb.OnPress); err != nil {
+		return err
 	}
 
 	for i, r := range *kb.Buttons {
 		if len(r.Row) > 8 {
 			return fmt.Errorf("слишком много кнопок в ряду %v", i)
 		}
+		for _, btn := range r.Row {
+			if err := validatePressMode(btn.OnPress); err != nil {
+				return err
+			}
+			if btn.RequestContact || btn.RequestLocation {
+				return fmt.Errorf("запрос контакта и геопозиции только в reply клавиатуре")
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateReplyKeyboard нажатия reply кнопок приходят текстом, поэтому тексты должны быть уникальны
+func validateReplyKeyboard(kb Keyboard) error {
+	if kb.PageSize != 0 || kb.OnPress != "" {
+		return fmt.Errorf("page_size и on_press не поддерживаются reply клавиатурой")
+	}
+
+	if kb.Placeholder != nil && len([]rune(*kb.Placeholder)) > 64 {
+		return fmt.Errorf("placeholder длиннее 64 символов")
+	}
+
+	texts := make(map[string]bool)
+	for i, r := range *kb.Buttons {
+		if len(r.Row) > 12 {
+			return fmt.Errorf("слишком много кнопок в ряду %v", i)
+		}
+		for _, btn := range r.Row {
+			if btn.OnPress != "" {
+				return fmt.Errorf("on_press не поддерживается reply клавиатурой")
+			}
+			if btn.RequestContact && btn.RequestLocation {
+				return fmt.Errorf("кнопка %s запрашивает и контакт и геопозицию", btn.Text)
+			}
+			if texts[btn.Text] {
+				return fmt.Errorf("кнопка %s повторяется", btn.Text)
+			}
+			texts[btn.Text] = true
+		}
+	}
+
+	return nil
+}
+
+func validateBot(config *BotConfig, secrets []Secret) error {
+	if config.ClaimSecret != nil && !secretRegistered(*config.ClaimSecret, secrets) {
+		return fmt.Errorf("секрет %s не зарегистрирован", *config.ClaimSecret)
+	}
+
+	switch config.Mode {
+	case "", BotMode_Polling:
+		return nil
+	case BotMode_Webhook:
+	default:
+		return fmt.Errorf("неизвестный режим %s", config.Mode)
+	}
+
+	if config.Webhook == nil {
+		return fmt.Errorf("заполните конфигурацию для вебхука")
+	}
+
+	if config.Webhook.Url == "" {
+		return fmt.Errorf("не указан публичный url вебхука")
+	}
+
+	if config.Webhook.Address == "" {
+		return fmt.Errorf("не указан адрес листенера вебхука")
+	}
+
+	//секрет должен быть зарегистрирован
+	if config.Webhook.Secret != nil && !secretRegistered(*config.Webhook.Secret, secrets) {
+		return fmt.Errorf("секрет %s не зарегистрирован", *config.Webhook.Secret)
 	}
 
 	return nil
@@ -62,11 +192,332 @@ func validateStorage(config *StorageConfig) error {
 	return nil
 }
 
+func secretRegistered(name string, secrets []Secret) bool {
+	for _, s := range secrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func validateCommand(config *Command) error {
-	if config.Use == CmdUse_Group {
-		if config.Form != nil {
-			return fmt.Errorf("Нельзя передавать формы в группы")
+	for _, use := range config.Use {
+		switch use {
+		case CmdUse_Private, CmdUse_Group, CmdUse_Channel:
+		default:
+			return fmt.Errorf("неизвестный тип чата %s", use)
+		}
+	}
+
+	if config.RemoveKeyboard && (config.Reply == nil || *config.Reply == "") {
+		return fmt.Errorf("клавиатура убирается вместе с ответом, укажите reply")
+	}
+
+	// формы привязаны к пользователю, в каналах его нет
+	if config.Form != nil && (config.Use.Has(CmdUse_Group) || config.Use.Has(CmdUse_Channel)) {
+		return fmt.Errorf("Нельзя передавать формы в группы и каналы")
+	}
+
+	return nil
+}
+
+func validateInterceptor(config *Interceptor) error {
+	switch config.Affects {
+	case AffectMode_All, AffectMode_Commands, AffectMode_Text, AffectMode_Buttons, AffectMode_Media, AffectMode_Url:
+	case AffectMode_Regex:
+		if config.Pattern == nil {
+			return fmt.Errorf("для режима regex нужен pattern")
+		}
+		if _, err := regexp.Compile(*config.Pattern); err != nil {
+			return fmt.Errorf("невалидная регулярка: %w", err)
+		}
+	case AffectMode_Filter:
+		if config.Filter == nil {
+			return fmt.Errorf("для режима filter нужен filter")
 		}
+		if err := validateLuaExpr(*config.Filter, "filter"); err != nil {
+			return fmt.Errorf("невалидное выражение фильтра: %w", err)
+		}
+	default:
+		return fmt.Errorf("неизвестный режим %s", config.Affects)
+	}
+
+	return nil
+}
+
+// validateLuaExpr выражение вычисляется как return (...), проверяем что оно парсится
+func validateLuaExpr(expr, name string) error {
+	code := strings.TrimSpace(expr)
+	if !strings.HasPrefix(code, "return") {
+		code = "return (" + code + ")"
+	}
+	_, err := parse.Parse(strings.NewReader(code), name)
+	return err
+}
+
+func validatePressMode(mode PressMode) error {
+	switch mode {
+	case "", PressMode_Delete, PressMode_Keep, PressMode_Edit:
+		return nil
+	}
+	return fmt.Errorf("неизвестный on_press %s", mode)
+}
+
+// validateRoles проверяет что все упомянутые роли объявлены в блоке roles
+func validateRoles(config *YamlConfig) error {
+	declared := make(map[string]bool, len(config.Roles))
+	for _, r := range config.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("роль без имени")
+		}
+		if declared[r.Name] {
+			return fmt.Errorf("роль %s объявлена дважды", r.Name)
+		}
+		declared[r.Name] = true
+	}
+
+	check := func(owner string, roles []string) error {
+		for _, r := range roles {
+			if !declared[r] {
+				return fmt.Errorf("%s: роль %s не объявлена", owner, r)
+			}
+		}
+		return nil
+	}
+
+	for _, cmd := range config.Commands {
+		if err := check("команда "+cmd.Name, cmd.Roles); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range config.Forms {
+		if err := check("форма "+f.Name, f.Roles); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range config.Media.Handlers {
+		if err := check("обработчик медиа "+h.Script, h.Roles); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range config.States {
+		if err := check("состояние "+st.Name, st.Roles); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range config.Keyboards {
+		if k.Buttons == nil {
+			continue
+		}
+		for _, r := range *k.Buttons {
+			for _, b := range r.Row {
+				if err := check("клавиатура "+k.Name, b.Roles); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateAdmin(config *AdminConfig) error {
+	names := make(map[string]bool)
+	for _, a := range config.Actions {
+		if a.Name == "" || strings.Contains(a.Name, ":") {
+			return fmt.Errorf("недопустимое имя действия %q", a.Name)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("действие %s объявлено дважды", a.Name)
+		}
+		names[a.Name] = true
+
+		if a.Script == "" {
+			return fmt.Errorf("не указан скрипт действия %s", a.Name)
+		}
+	}
+
+	return nil
+}
+
+func validateSessions(config *SessionConfig) error {
+	switch config.Type {
+	case "", Session_Cache, Session_Storage:
+	default:
+		return fmt.Errorf("неизвестный тип хранилища сессий %s", config.Type)
+	}
+
+	if config.TTL != "" {
+		if d, err := time.ParseDuration(config.TTL); err != nil || d <= 0 {
+			return fmt.Errorf("некорректный ttl %s", config.TTL)
+		}
+	}
+	return nil
+}
+
+func validateReload(config *ReloadConfig) error {
+	if config.Interval != "" {
+		if d, err := time.ParseDuration(config.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("некорректный interval %s", config.Interval)
+		}
+	}
+	return nil
+}
+
+func validateStates(states []State) error {
+	names := make(map[string]bool, len(states))
+	for i, st := range states {
+		if st.Name == "" {
+			return fmt.Errorf("состояние #%d: не указано имя", i)
+		}
+		if names[st.Name] {
+			return fmt.Errorf("состояние %s объявлено дважды", st.Name)
+		}
+		names[st.Name] = true
+
+		if st.Script == "" {
+			return fmt.Errorf("состояние %s: не указан скрипт", st.Name)
+		}
+	}
+	return nil
+}
+
+func validateMedia(config *MediaConfig) error {
+	switch config.Type {
+	case "", "local":
+	default:
+		return fmt.Errorf("неизвестный тип хранилища медиа %s", config.Type)
+	}
+
+	for i, h := range config.Handlers {
+		switch h.Kind {
+		case "", MediaKind_Photo, MediaKind_Document, MediaKind_Audio, MediaKind_Video,
+			MediaKind_Voice, MediaKind_VideoNote, MediaKind_Animation, MediaKind_Sticker:
+		default:
+			return fmt.Errorf("обработчик #%d: неизвестный тип вложения %s", i, h.Kind)
+		}
+
+		if h.Script == "" {
+			return fmt.Errorf("обработчик #%d: не указан скрипт", i)
+		}
+	}
+
+	return nil
+}
+
+func validateForm(form *Form, media *MediaConfig) error {
+	if form.Timeout != "" {
+		if d, err := time.ParseDuration(form.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("некорректный timeout %s", form.Timeout)
+		}
+	}
+	if (form.Back != nil && form.Back.Message != nil) || (form.Skip != nil && form.Skip.Message != nil) {
+		return fmt.Errorf("message задается только для cancel")
+	}
+
+	if form.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts не может быть отрицательным")
+	}
+
+	// на поля ссылаются условия и переходы
+	fields := make(map[string]bool, len(form.Stages))
+	for _, st := range form.Stages {
+		if st.Field == "" {
+			return fmt.Errorf("у этапа не задано поле")
+		}
+		if fields[st.Field] {
+			return fmt.Errorf("поле %s задано дважды", st.Field)
+		}
+		fields[st.Field] = true
+	}
+
+	// луа скрипты проверок тут не запускаются, проверяются только параметры правил
+	validators := validation.NewRegistry(nil)
+
+	for _, st := range form.Stages {
+		if st.MaxAttempts < 0 {
+			return fmt.Errorf("этап %s: max_attempts не может быть отрицательным", st.Field)
+		}
+		if st.Validation != nil {
+			if st.Input != "" && st.Input != FormInput_Text {
+				return fmt.Errorf("этап %s: validation только для текстового ввода", st.Field)
+			}
+			if _, err := validators.Build(*st.Validation); err != nil {
+				return fmt.Errorf("этап %s: %w", st.Field, err)
+			}
+		}
+		if err := validateCondition(st.When, fields); err != nil {
+			return fmt.Errorf("этап %s: %w", st.Field, err)
+		}
+		for _, jump := range st.Next {
+			if jump.Goto != FormEnd && !fields[jump.Goto] {
+				return fmt.Errorf("этап %s: переход на несуществующее поле %s", st.Field, jump.Goto)
+			}
+			if err := validateCondition(jump.When, fields); err != nil {
+				return fmt.Errorf("этап %s: переход на %s: %w", st.Field, jump.Goto, err)
+			}
+		}
+
+		switch st.Input {
+		case "", FormInput_Text, FormInput_Contact, FormInput_Location:
+		case FormInput_Photo, FormInput_Document:
+			if st.Save && media.Type == "" {
+				return fmt.Errorf("этап %s: для save нужно хранилище медиа", st.Field)
+			}
+		case FormInput_Choice:
+			if len(st.Options) == 0 || len(st.Options) > 10 {
+				return fmt.Errorf("этап %s: у выбора должно быть от 1 до 10 вариантов", st.Field)
+			}
+			if st.MaxChoices < 0 || st.MinChoices < 0 || (st.MaxChoices > 0 && st.MinChoices > st.MaxChoices) {
+				return fmt.Errorf("этап %s: некорректные min_choices/max_choices", st.Field)
+			}
+			if st.Keyboard != nil {
+				return fmt.Errorf("этап %s: клавиатура выбора строится из options", st.Field)
+			}
+		default:
+			return fmt.Errorf("этап %s: неизвестный тип ввода %s", st.Field, st.Input)
+		}
+	}
+
+	return nil
+}
+
+// validateCondition условие задается либо по полю, либо луа выражением
+func validateCondition(cond *FormCondition, fields map[string]bool) error {
+	if cond == nil {
+		return nil
+	}
+
+	if cond.Lua != "" {
+		if cond.Field != "" {
+			return fmt.Errorf("в условии нужно либо field, либо lua")
+		}
+		if err := validateLuaExpr(cond.Lua, "when"); err != nil {
+			return fmt.Errorf("невалидное выражение условия: %w", err)
+		}
+		return nil
+	}
+
+	if cond.Field == "" {
+		return fmt.Errorf("в условии не задано ни field, ни lua")
+	}
+	if !fields[cond.Field] {
+		return fmt.Errorf("условие по несуществующему полю %s", cond.Field)
+	}
+
+	ops := 0
+	for _, set := range []bool{cond.Equals != nil, cond.NotEquals != nil, cond.In != nil, cond.Filled != nil} {
+		if set {
+			ops++
+		}
+	}
+	if ops > 1 {
+		return fmt.Errorf("в условии по полю %s больше одного оператора", cond.Field)
 	}
 
 	return nil
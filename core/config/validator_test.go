@@ -32,16 +32,34 @@ func TestValidateKeyboard(t *testing.T) {
 			errContains: "пустая клавиатура",
 		},
 		{
-			name: "too many rows",
+			name: "many rows are paged",
 			keyboard: Keyboard{
-				Name: "too_many_rows",
+				Name: "many_rows",
 				Buttons: &[]KeyboardRow{
 					{}, {}, {}, {}, {}, {}, {}, {}, {}, {}, {},
 				},
 			},
+			wantErr: false,
+		},
+		{
+			name: "too many rows on page",
+			keyboard: Keyboard{
+				Name:     "too_many_rows",
+				Buttons:  &[]KeyboardRow{{}},
+				PageSize: 11,
+			},
 			wantErr:     true,
 			errContains: "слишком много рядов",
 		},
+		{
+			name: "unknown on_press",
+			keyboard: Keyboard{
+				Name:    "bad_press",
+				Buttons: &[]KeyboardRow{{Row: []Button{{Text: "a", OnPress: "hide"}}}},
+			},
+			wantErr:     true,
+			errContains: "неизвестный on_press",
+		},
 		{
 			name: "too many buttons in row",
 			keyboard: Keyboard{
@@ -53,6 +71,47 @@ func TestValidateKeyboard(t *testing.T) {
 			wantErr:     true,
 			errContains: "слишком много кнопок в ряду",
 		},
+		{
+			name: "valid reply keyboard",
+			keyboard: Keyboard{
+				Name:   "reply_kb",
+				Type:   KeyboardType_Reply,
+				Resize: true,
+				Buttons: &[]KeyboardRow{
+					{Row: []Button{{Text: "Меню"}, {Text: "Контакт", RequestContact: true}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate reply button text",
+			keyboard: Keyboard{
+				Name:    "dup_reply",
+				Type:    KeyboardType_Reply,
+				Buttons: &[]KeyboardRow{{Row: []Button{{Text: "a"}}}, {Row: []Button{{Text: "a"}}}},
+			},
+			wantErr:     true,
+			errContains: "повторяется",
+		},
+		{
+			name: "request contact in inline keyboard",
+			keyboard: Keyboard{
+				Name:    "inline_contact",
+				Buttons: &[]KeyboardRow{{Row: []Button{{Text: "a", RequestContact: true}}}},
+			},
+			wantErr:     true,
+			errContains: "только в reply",
+		},
+		{
+			name: "unknown keyboard type",
+			keyboard: Keyboard{
+				Name:    "bad_type",
+				Type:    "popup",
+				Buttons: &[]KeyboardRow{{}},
+			},
+			wantErr:     true,
+			errContains: "неизвестный тип клавиатуры",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -82,7 +141,7 @@ func TestValidateCommands(t *testing.T) {
 				{
 					Name:        "valid",
 					Description: "",
-					Use:         CmdUse_Private,
+					Use:         CmdUses{CmdUse_Private},
 					Form:        &form,
 				},
 			},
@@ -100,7 +159,7 @@ func TestValidateCommands(t *testing.T) {
 				{
 					Name:        "invalid",
 					Description: "",
-					Use:         CmdUse_Group,
+					Use:         CmdUses{CmdUse_Group},
 					Form:        &form,
 				},
 			},
@@ -111,6 +170,196 @@ func TestValidateCommands(t *testing.T) {
 			t.Errorf("config should be invalid, got error: %s", msg)
 		}
 	})
+
+	t.Run("remove keyboard without reply", func(t *testing.T) {
+		cfg := &YamlConfig{
+			Commands: []Command{{Name: "hide", RemoveKeyboard: true}},
+		}
+
+		if valid, _ := Validate(cfg); valid {
+			t.Error("config should be invalid")
+		}
+	})
+}
+
+func TestValidateInterceptors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		inter   Interceptor
+		wantErr bool
+	}{
+		{name: "all", inter: Interceptor{Affects: AffectMode_All}},
+		{name: "url", inter: Interceptor{Affects: AffectMode_Url}},
+		{name: "unknown mode", inter: Interceptor{Affects: "smth"}, wantErr: true},
+		{name: "regex", inter: Interceptor{Affects: AffectMode_Regex, Pattern: strPtr(`^\d+$`)}},
+		{name: "regex without pattern", inter: Interceptor{Affects: AffectMode_Regex}, wantErr: true},
+		{name: "broken regex", inter: Interceptor{Affects: AffectMode_Regex, Pattern: strPtr(`(`)}, wantErr: true},
+		{name: "filter", inter: Interceptor{Affects: AffectMode_Filter, Filter: strPtr(`ctx.user.id == 1`)}},
+		{name: "filter with return", inter: Interceptor{Affects: AffectMode_Filter, Filter: strPtr(`return ctx.text ~= ""`)}},
+		{name: "broken filter", inter: Interceptor{Affects: AffectMode_Filter, Filter: strPtr(`ctx.user.id ==`)}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateInterceptor(&tc.inter)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateForm(t *testing.T) {
+	options := []FormOption{{Text: "A", Value: "a"}, {Text: "B", Value: "b"}}
+	local := &MediaConfig{Type: "local"}
+
+	testCases := []struct {
+		name    string
+		stage   FormStage
+		media   *MediaConfig
+		wantErr bool
+	}{
+		{name: "text", stage: FormStage{Field: "name"}, media: &MediaConfig{}},
+		{name: "unknown input", stage: FormStage{Field: "x", Input: "sticker"}, media: &MediaConfig{}, wantErr: true},
+		{name: "photo", stage: FormStage{Field: "pic", Input: FormInput_Photo}, media: &MediaConfig{}},
+		{name: "save photo", stage: FormStage{Field: "pic", Input: FormInput_Photo, Save: true}, media: local},
+		{name: "save without store", stage: FormStage{Field: "pic", Input: FormInput_Photo, Save: true}, media: &MediaConfig{}, wantErr: true},
+		{name: "choice", stage: FormStage{Field: "c", Input: FormInput_Choice, Options: options, MaxChoices: 2}, media: &MediaConfig{}},
+		{name: "choice without options", stage: FormStage{Field: "c", Input: FormInput_Choice}, media: &MediaConfig{}, wantErr: true},
+		{name: "choice min over max", stage: FormStage{Field: "c", Input: FormInput_Choice, Options: options, MinChoices: 2, MaxChoices: 1}, media: &MediaConfig{}, wantErr: true},
+		{name: "choice with keyboard", stage: FormStage{Field: "c", Input: FormInput_Choice, Options: options, Keyboard: strPtr("kb")}, media: &MediaConfig{}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateForm(&Form{Name: "f", Stages: []FormStage{tc.stage}}, tc.media)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		if err := validateForm(&Form{Name: "f", Timeout: "10m"}, &MediaConfig{}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := validateForm(&Form{Name: "f", Timeout: "десять минут"}, &MediaConfig{}); err == nil {
+			t.Error("expected error for broken timeout")
+		}
+		if err := validateForm(&Form{Name: "f", Back: &FormControl{Message: strPtr("назад")}}, &MediaConfig{}); err == nil {
+			t.Error("expected error for back message")
+		}
+	})
+
+	t.Run("stage validation", func(t *testing.T) {
+		ok := &map[string]any{"type": "phone"}
+		if err := validateForm(&Form{Name: "f", Stages: []FormStage{{Field: "phone", Validation: ok}}}, &MediaConfig{}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		broken := &map[string]any{"type": "regex", "pattern": "("}
+		if err := validateForm(&Form{Name: "f", Stages: []FormStage{{Field: "code", Validation: broken}}}, &MediaConfig{}); err == nil {
+			t.Error("expected error for broken rule")
+		}
+		if err := validateForm(&Form{Name: "f", Stages: []FormStage{{Field: "pic", Input: FormInput_Photo, Validation: ok}}}, &MediaConfig{}); err == nil {
+			t.Error("expected error for validation on photo stage")
+		}
+		if err := validateForm(&Form{Name: "f", MaxAttempts: -1}, &MediaConfig{}); err == nil {
+			t.Error("expected error for negative max_attempts")
+		}
+	})
+
+	t.Run("branching", func(t *testing.T) {
+		stages := func(when *FormCondition, next ...FormJump) []FormStage {
+			return []FormStage{{Field: "delivery", Next: next}, {Field: "address", When: when}}
+		}
+		cases := []struct {
+			name    string
+			stages  []FormStage
+			wantErr bool
+		}{
+			{name: "field condition", stages: stages(&FormCondition{Field: "delivery", Equals: strPtr("courier")})},
+			{name: "lua condition", stages: stages(&FormCondition{Lua: `ctx.form_data.delivery == "courier"`})},
+			{name: "jump to end", stages: stages(nil, FormJump{Goto: FormEnd})},
+			{name: "jump to unknown field", stages: stages(nil, FormJump{Goto: "phone"}), wantErr: true},
+			{name: "condition on unknown field", stages: stages(&FormCondition{Field: "phone"}), wantErr: true},
+			{name: "field and lua", stages: stages(&FormCondition{Field: "delivery", Lua: "true"}), wantErr: true},
+			{name: "broken lua", stages: stages(&FormCondition{Lua: "ctx.form_data =="}), wantErr: true},
+			{name: "two operators", stages: stages(&FormCondition{Field: "delivery", Equals: strPtr("a"), In: []string{"b"}}), wantErr: true},
+			{name: "duplicated field", stages: []FormStage{{Field: "a"}, {Field: "a"}}, wantErr: true},
+		}
+		for _, tc := range cases {
+			err := validateForm(&Form{Name: "f", Stages: tc.stages}, &MediaConfig{})
+			if tc.wantErr != (err != nil) {
+				t.Errorf("%s: wantErr %v, got %v", tc.name, tc.wantErr, err)
+			}
+		}
+	})
+}
+
+func TestValidateSessions(t *testing.T) {
+	if err := validateSessions(&SessionConfig{}); err != nil {
+		t.Errorf("empty config should use defaults: %v", err)
+	}
+	if err := validateSessions(&SessionConfig{Type: Session_Storage, TTL: "12h"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateSessions(&SessionConfig{Type: "postgres"}); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	if err := validateSessions(&SessionConfig{TTL: "сутки"}); err == nil {
+		t.Error("expected error for broken ttl")
+	}
+}
+
+func TestValidateStates(t *testing.T) {
+	testCases := []struct {
+		name    string
+		states  []State
+		wantErr bool
+	}{
+		{name: "valid", states: []State{{Name: "ask_age", Script: "dialog/age"}, {Name: "ask_city", Script: "dialog/city"}}},
+		{name: "no name", states: []State{{Script: "dialog/age"}}, wantErr: true},
+		{name: "no script", states: []State{{Name: "ask_age"}}, wantErr: true},
+		{name: "duplicate", states: []State{{Name: "ask_age", Script: "a"}, {Name: "ask_age", Script: "b"}}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateStates(tc.states); (err != nil) != tc.wantErr {
+				t.Errorf("validateStates() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRoles(t *testing.T) {
+	roles := []Role{{Name: "manager"}}
+
+	cfg := &YamlConfig{Roles: roles, Commands: []Command{{Name: "stats", Roles: []string{"manager"}}}}
+	if err := validateRoles(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg = &YamlConfig{Roles: roles, Forms: []Form{{Name: "order", Roles: []string{"vip"}}}}
+	if err := validateRoles(cfg); err == nil {
+		t.Error("expected error for undeclared role")
+	}
+
+	cfg = &YamlConfig{Roles: roles, States: []State{{Name: "ask_age", Script: "dialog/age", Roles: []string{"manger"}}}}
+	if err := validateRoles(cfg); err == nil {
+		t.Error("expected error for undeclared state role")
+	}
+
+	cfg = &YamlConfig{Roles: append(roles, Role{Name: "manager"})}
+	if err := validateRoles(cfg); err == nil {
+		t.Error("expected error for duplicated role")
+	}
 }
 
 func TestValidateConfig(t *testing.T) {
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// advance переходит к следующему этапу после текущего или завершает форму
+func (fw *FormWorker) advance(sess *FormSession, form *c.Form, upd *tgbotapi.Update) {
+	next := fw.showable(sess, form, fw.jumpTarget(sess, form, sess.Step, upd), upd)
+	if next >= len(form.Stages) {
+		fw.completeForm(sess, form, upd)
+		return
+	}
+
+	sess.History = append(sess.History, sess.Step)
+	sess.Step = next
+	if err := fw.sendFormStep(sess, form, upd); err != nil {
+		logrus.Errorf("ошибка отправки этапа формы %s: %v", form.Name, err)
+	}
+}
+
+// jumpTarget индекс этапа по первому подходящему переходу next, иначе следующий по порядку
+func (fw *FormWorker) jumpTarget(sess *FormSession, form *c.Form, from int, upd *tgbotapi.Update) int {
+	for _, jump := range form.Stages[from].Next {
+		if !fw.conditionMet(sess, jump.When, upd) {
+			continue
+		}
+		if jump.Goto == c.FormEnd {
+			return len(form.Stages)
+		}
+		if i := stageIndex(form, jump.Goto); i >= 0 {
+			return i
+		}
+		logrus.Errorf("форма %s: переход на несуществующее поле %s", form.Name, jump.Goto)
+	}
+	return from + 1
+}
+
+// showable первый этап начиная с from, чье условие when выполнено
+func (fw *FormWorker) showable(sess *FormSession, form *c.Form, from int, upd *tgbotapi.Update) int {
+	for from < len(form.Stages) && !fw.conditionMet(sess, form.Stages[from].When, upd) {
+		from++
+	}
+	return from
+}
+
+func (fw *FormWorker) conditionMet(sess *FormSession, cond *c.FormCondition, upd *tgbotapi.Update) bool {
+	if cond == nil {
+		return true
+	}
+
+	data := fw.collectFormData(sess)
+	if cond.Lua == "" {
+		return matchField(cond, data)
+	}
+
+	ctx := l.LuaContext{ChatId: sess.UserId, FromId: sess.UserId}
+	if upd != nil {
+		ctx = updateContext(upd)
+	}
+	ctx.FormData = data
+
+	ok, err := fw.le.EvalExpression(cond.Lua, ctx)
+	if err != nil {
+		logrus.Errorf("ошибка условия формы: %v", err)
+		return false
+	}
+	return ok
+}
+
+// matchField сравнение поля формы, для выбора с несколькими вариантами достаточно одного совпадения
+func matchField(cond *c.FormCondition, data map[string]interface{}) bool {
+	raw, filled := data[cond.Field]
+
+	var values []string
+	switch v := raw.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+	default:
+		values = []string{fmt.Sprint(v)}
+	}
+
+	switch {
+	case cond.Equals != nil:
+		return slices.Contains(values, *cond.Equals)
+	case cond.NotEquals != nil:
+		return !slices.Contains(values, *cond.NotEquals)
+	case cond.In != nil:
+		return slices.ContainsFunc(values, func(v string) bool { return slices.Contains(cond.In, v) })
+	case cond.Filled != nil:
+		return filled == *cond.Filled
+	}
+	return filled
+}
+
+func stageIndex(form *c.Form, field string) int {
+	return slices.IndexFunc(form.Stages, func(st c.FormStage) bool { return st.Field == field })
+}
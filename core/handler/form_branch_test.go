@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"testing"
+
+	c "github.com/end1essrage/indigo-core/config"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestMatchField(t *testing.T) {
+	data := map[string]interface{}{"delivery": "courier", "toppings": []interface{}{"cheese", "ham"}}
+	yes, no := true, false
+
+	testCases := []struct {
+		name string
+		cond c.FormCondition
+		want bool
+	}{
+		{name: "equals", cond: c.FormCondition{Field: "delivery", Equals: strPtr("courier")}, want: true},
+		{name: "equals other", cond: c.FormCondition{Field: "delivery", Equals: strPtr("pickup")}, want: false},
+		{name: "not equals", cond: c.FormCondition{Field: "delivery", NotEquals: strPtr("pickup")}, want: true},
+		{name: "in", cond: c.FormCondition{Field: "delivery", In: []string{"pickup", "courier"}}, want: true},
+		{name: "choice contains", cond: c.FormCondition{Field: "toppings", Equals: strPtr("ham")}, want: true},
+		{name: "filled by default", cond: c.FormCondition{Field: "delivery"}, want: true},
+		{name: "skipped field", cond: c.FormCondition{Field: "comment"}, want: false},
+		{name: "not filled", cond: c.FormCondition{Field: "comment", Filled: &no}, want: true},
+		{name: "filled", cond: c.FormCondition{Field: "comment", Filled: &yes}, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := matchField(&tc.cond, data); got != tc.want {
+				t.Errorf("matchField = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStageRouting(t *testing.T) {
+	form := &c.Form{Name: "order", Stages: []c.FormStage{
+		{Field: "delivery", Next: []c.FormJump{
+			{When: &c.FormCondition{Field: "delivery", Equals: strPtr("pickup")}, Goto: "comment"},
+		}},
+		{Field: "address"},
+		{Field: "floor", When: &c.FormCondition{Field: "address"}},
+		{Field: "comment", Optional: true, Next: []c.FormJump{{Goto: c.FormEnd}}},
+	}}
+
+	fw := &FormWorker{internal: map[string]internalForm{"order": {form: form}}}
+	sess := NewFormSession(1, "order")
+
+	sess.Answers["delivery"] = "courier"
+	if got := fw.jumpTarget(sess, form, 0, nil); got != 1 {
+		t.Errorf("courier should go to address, got %d", got)
+	}
+
+	sess.Answers["delivery"] = "pickup"
+	if got := fw.jumpTarget(sess, form, 0, nil); got != 3 {
+		t.Errorf("pickup should jump to comment, got %d", got)
+	}
+
+	if got := fw.showable(sess, form, 2, nil); got != 3 {
+		t.Errorf("floor without address should be skipped, got %d", got)
+	}
+	sess.Answers["address"] = "Lenina 1"
+	if got := fw.showable(sess, form, 2, nil); got != 2 {
+		t.Errorf("floor with address should be shown, got %d", got)
+	}
+
+	if got := fw.jumpTarget(sess, form, 3, nil); got != len(form.Stages) {
+		t.Errorf("goto end should finish form, got %d", got)
+	}
+}
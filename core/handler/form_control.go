@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	b "github.com/end1essrage/indigo-core/bot"
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	formActionCancel = "cancel"
+	formActionBack   = "back"
+	formActionSkip   = "skip"
+
+	defaultCancelMessage    = "Форма отменена"
+	defaultTimeoutMessage   = "Время заполнения формы истекло"
+	defaultErrorMessage     = "Неверный ввод, попробуйте еще раз"
+	attemptsExceededMessage = "Слишком много неверных попыток, форма отменена"
+)
+
+// controlAction отмена, возврат или пропуск: кнопка формы, /cancel, /skip или слово из конфига
+func controlAction(form *c.Form, upd *tgbotapi.Update, cbData l.LuaCbData) string {
+	if upd.CallbackQuery != nil {
+		namespace, action, ok := b.ParseNamespacedScript(cbData.Script)
+		if ok && namespace == b.CbNamespace_Form && (action == formActionCancel || action == formActionBack || action == formActionSkip) {
+			return action
+		}
+		return ""
+	}
+
+	msg := upd.Message
+	if msg.IsCommand() {
+		switch msg.Command() {
+		case "cancel":
+			return formActionCancel
+		case "skip":
+			return formActionSkip
+		}
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	switch {
+	case text == "":
+		return ""
+	case matchesControl(form.Cancel, text):
+		return formActionCancel
+	case matchesControl(form.Back, text):
+		return formActionBack
+	case matchesControl(form.Skip, text):
+		return formActionSkip
+	}
+	return ""
+}
+
+// matchesControl текст совпадает со словом или кнопкой (нажатия reply кнопок приходят текстом)
+func matchesControl(ctl *c.FormControl, text string) bool {
+	if ctl == nil {
+		return false
+	}
+	if ctl.Button != "" && strings.EqualFold(ctl.Button, text) {
+		return true
+	}
+	for _, w := range ctl.Words {
+		if strings.EqualFold(w, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// withControls добавляет кнопки отмены, возврата и пропуска к клавиатуре этапа
+func withControls(markup b.Markup, form *c.Form, canBack, canSkip bool) b.Markup {
+	row := controlRow(form, canBack, canSkip)
+	if len(row) == 0 {
+		return markup
+	}
+
+	switch kb := markup.(type) {
+	case nil:
+		return b.MeshInlineKeyboard{Rows: [][]b.MeshInlineButton{row}}
+	case b.MeshInlineKeyboard:
+		kb.Rows = append(kb.Rows, row)
+		return kb
+	case b.MeshReplyKeyboard:
+		replyRow := make([]b.MeshReplyButton, 0, len(row))
+		for _, btn := range row {
+			replyRow = append(replyRow, b.MeshReplyButton{Text: btn.Text})
+		}
+		kb.Rows = append(kb.Rows, replyRow)
+		return kb
+	}
+	return markup
+}
+
+// controlRow назад - если есть пройденные этапы, пропуск - только на необязательных
+func controlRow(form *c.Form, canBack, canSkip bool) []b.MeshInlineButton {
+	var row []b.MeshInlineButton
+	if form.Back != nil && form.Back.Button != "" && canBack {
+		row = append(row, b.MeshInlineButton{Text: form.Back.Button, Script: b.NamespacedScript(b.CbNamespace_Form, formActionBack)})
+	}
+	if form.Skip != nil && form.Skip.Button != "" && canSkip {
+		row = append(row, b.MeshInlineButton{Text: form.Skip.Button, Script: b.NamespacedScript(b.CbNamespace_Form, formActionSkip)})
+	}
+	if form.Cancel != nil && form.Cancel.Button != "" {
+		row = append(row, b.MeshInlineButton{Text: form.Cancel.Button, Script: b.NamespacedScript(b.CbNamespace_Form, formActionCancel)})
+	}
+	return row
+}
+
+// stepBack возвращает на предыдущий пройденный этап и задает его вопрос заново
+func (fw *FormWorker) stepBack(sess *FormSession, form *c.Form, upd *tgbotapi.Update) {
+	if n := len(sess.History); n > 0 {
+		sess.Step = sess.History[n-1]
+		sess.History = sess.History[:n-1]
+
+		// ответы этапов вне оставшегося пути больше не действительны, иначе попадут в условия и ctx.form_data
+		for i, st := range form.Stages {
+			if !slices.Contains(sess.History, i) {
+				delete(sess.Answers, st.Field)
+			}
+		}
+	}
+
+	if err := fw.sendFormStep(sess, form, upd); err != nil {
+		logrus.Errorf("ошибка возврата на этап формы %s: %v", form.Name, err)
+	}
+}
+
+// cancelForm сбрасывает форму по просьбе пользователя
+func (fw *FormWorker) cancelForm(sess *FormSession, form *c.Form, upd *tgbotapi.Update) {
+	text := defaultCancelMessage
+	if form.Cancel != nil && form.Cancel.Message != nil {
+		text = *form.Cancel.Message
+	}
+	fw.abortForm(sess, form, upd, text)
+}
+
+// abortForm сброс формы с сообщением и скриптом on_cancel
+func (fw *FormWorker) abortForm(sess *FormSession, form *c.Form, upd *tgbotapi.Update, text string) {
+	data := fw.collectFormData(sess)
+	fw.clearFormData(sess.UserId)
+	fw.sendExit(sess.UserId, text)
+
+	if form.OnCancel != nil && *form.OnCancel != "" {
+		ctx := updateContext(upd)
+		ctx.FormData = data
+		if err := fw.le.ExecuteScript(*form.OnCancel, ctx); err != nil {
+			logrus.Errorf("Form cancel script error: %v", err)
+		}
+	}
+}
+
+// timeoutForm сбрасывает форму после бездействия, у скрипта нет обновления - только пользователь и данные
+func (fw *FormWorker) timeoutForm(sess *FormSession, form *c.Form) {
+	data := fw.collectFormData(sess)
+	fw.clearFormData(sess.UserId)
+
+	text := defaultTimeoutMessage
+	if form.TimeoutMessage != nil {
+		text = *form.TimeoutMessage
+	}
+	fw.sendExit(sess.UserId, text)
+
+	if form.OnTimeout != nil && *form.OnTimeout != "" {
+		ctx := l.LuaContext{ChatId: sess.UserId, FromId: sess.UserId, FormData: data}
+		if err := fw.le.ExecuteScript(*form.OnTimeout, ctx); err != nil {
+			logrus.Errorf("Form timeout script error: %v", err)
+		}
+	}
+}
+
+// sendExit сообщение о выходе из формы, заодно убирает reply клавиатуру этапа
+func (fw *FormWorker) sendExit(userID int64, text string) {
+	if text == "" {
+		return
+	}
+	if _, err := fw.bot.SendOpts(userID, text, b.MeshReplyKeyboard{Remove: true}, b.SendOptions{}); err != nil {
+		logrus.Errorf("ошибка отправки сообщения выхода из формы: %v", err)
+	}
+}
+
+// touch продлевает срок формы, таймер сбросит ее если пользователь замолчит. Сессию сохраняет вызывающий
+func (fw *FormWorker) touch(sess *FormSession, form *c.Form) {
+	timeout := form.TimeoutDuration()
+	if timeout == 0 {
+		return
+	}
+	sess.Deadline = time.Now().Add(timeout).UnixMilli()
+
+	userID := sess.UserId
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if t, ok := fw.timers[userID]; ok {
+		t.Stop()
+	}
+	fw.timers[userID] = time.AfterFunc(timeout, func() { fw.expire(userID) })
+}
+
+// expired срок формы прошел, проверяется и при вводе: после перезапуска таймеров нет
+func expired(sess *FormSession) bool {
+	return sess.Deadline > 0 && time.Now().UnixMilli() >= sess.Deadline
+}
+
+func (fw *FormWorker) expire(userID int64) {
+	// под той же блокировкой что и ввод: сессию читаем после того как ввод ее сохранил
+	defer fw.lockUser(userID)()
+
+	// форму могли продлить, завершить или отменить пока таймер ждал, поэтому дедлайн проверяется заново
+	sess := fw.session(userID)
+	if sess == nil || !expired(sess) {
+		return
+	}
+
+	form := fw.getForm(sess.Form)
+	if form == nil {
+		fw.clearFormData(userID)
+		return
+	}
+	fw.timeoutForm(sess, form)
+}
+
+func (fw *FormWorker) stopTimer(userID int64) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if t, ok := fw.timers[userID]; ok {
+		t.Stop()
+		delete(fw.timers, userID)
+	}
+}
+
+// Stop останавливает таймеры форм, при вводе после перезапуска срок проверится по буферу
+func (fw *FormWorker) Stop() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	for id, t := range fw.timers {
+		t.Stop()
+		delete(fw.timers, id)
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	b "github.com/end1essrage/indigo-core/bot"
+	"github.com/end1essrage/indigo-core/cache"
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestControlAction(t *testing.T) {
+	form := &c.Form{
+		Cancel: &c.FormControl{Words: []string{"отмена"}, Button: "❌ Отмена"},
+		Back:   &c.FormControl{Words: []string{"назад"}},
+	}
+	text := func(s string) *tgbotapi.Update {
+		msg := &tgbotapi.Message{Text: s}
+		if s == "/cancel" {
+			msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(s)}}
+		}
+		return &tgbotapi.Update{Message: msg}
+	}
+	press := &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{}}
+
+	testCases := []struct {
+		name string
+		form *c.Form
+		upd  *tgbotapi.Update
+		cb   l.LuaCbData
+		want string
+	}{
+		{name: "cancel command without config", form: &c.Form{}, upd: text("/cancel"), want: formActionCancel},
+		{name: "cancel word any case", form: form, upd: text(" Отмена "), want: formActionCancel},
+		{name: "reply cancel button", form: form, upd: text("❌ Отмена"), want: formActionCancel},
+		{name: "back word", form: form, upd: text("назад"), want: formActionBack},
+		{name: "regular text", form: form, upd: text("Вася"), want: ""},
+		{name: "back button", form: form, upd: press, cb: l.LuaCbData{Script: b.NamespacedScript(b.CbNamespace_Form, formActionBack)}, want: formActionBack},
+		{name: "choice button", form: form, upd: press, cb: l.LuaCbData{Script: b.NamespacedScript(b.CbNamespace_Form, formActionPick)}, want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := controlAction(tc.form, tc.upd, tc.cb); got != tc.want {
+				t.Errorf("action = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithControls(t *testing.T) {
+	form := &c.Form{Cancel: &c.FormControl{Button: "Отмена"}, Back: &c.FormControl{Button: "Назад"}}
+
+	// на первом этапе только отмена
+	kb, ok := withControls(nil, form, false, false).(b.MeshInlineKeyboard)
+	if !ok || len(kb.Rows) != 1 || len(kb.Rows[0]) != 1 || kb.Rows[0][0].Text != "Отмена" {
+		t.Fatalf("unexpected first stage controls %+v", kb)
+	}
+
+	reply, ok := withControls(b.MeshReplyKeyboard{Rows: [][]b.MeshReplyButton{{{Text: "Да"}}}}, form, true, false).(b.MeshReplyKeyboard)
+	if !ok || len(reply.Rows) != 2 || len(reply.Rows[1]) != 2 {
+		t.Fatalf("controls should be appended to reply keyboard, got %+v", reply)
+	}
+
+	if withControls(nil, &c.Form{}, true, true) != nil {
+		t.Error("form without buttons should not get keyboard")
+	}
+}
+
+func TestFormDeadline(t *testing.T) {
+	fw := &FormWorker{timers: make(map[int64]*time.Timer)}
+	defer fw.Stop()
+
+	sess := NewFormSession(1, "order")
+	fw.touch(sess, &c.Form{})
+	if expired(sess) || len(fw.timers) != 0 {
+		t.Fatal("form without timeout should not expire")
+	}
+
+	fw.touch(sess, &c.Form{Timeout: "1h"})
+	if expired(sess) || len(fw.timers) != 1 {
+		t.Fatal("fresh form should not be expired")
+	}
+
+	sess.Deadline = 1
+	if !expired(sess) {
+		t.Error("form past deadline should be expired")
+	}
+}
+
+func TestExpireWaitsForInput(t *testing.T) {
+	memory := cache.NewInMemoryCache(time.Minute)
+	defer memory.Stop()
+	sessions := NewCacheSessions(memory, time.Hour)
+	fw := &FormWorker{sessions: sessions, timers: make(map[int64]*time.Timer)}
+	defer fw.Stop()
+
+	// таймер сработал по старому дедлайну, пока ввод еще обрабатывается
+	sess := NewFormSession(1, "order")
+	sess.Deadline = 1
+	if err := sessions.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock := fw.lockUser(1)
+	done := make(chan struct{})
+	go func() {
+		fw.expire(1)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expire should wait for input lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// ввод продлил форму и сохранил сессию
+	sess.Deadline = time.Now().Add(time.Hour).UnixMilli()
+	sess.Step = 1
+	if err := sessions.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	<-done
+
+	got, err := sessions.Get(1)
+	if err != nil || got == nil || got.Step != 1 {
+		t.Errorf("extended session should survive expire, got %+v %v", got, err)
+	}
+}
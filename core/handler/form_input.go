@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	b "github.com/end1essrage/indigo-core/bot"
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	m "github.com/end1essrage/indigo-core/mapper"
+	"github.com/end1essrage/indigo-core/media"
+	"github.com/end1essrage/indigo-core/validation"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	formActionPick = "pick"
+	formActionDone = "done"
+)
+
+// readInput значение этапа из сообщения или нажатия, ошибка - ввод не подходит этапу
+func (fw *FormWorker) readInput(userID int64, step c.FormStage, upd *tgbotapi.Update, cbData l.LuaCbData) (string, error) {
+	if upd.CallbackQuery != nil {
+		// кнопки выбора с прошлых этапов не считаются ответом, нажатием можно ответить только на текстовый этап
+		namespace, _, ok := b.ParseNamespacedScript(cbData.Script)
+		if (ok && namespace == b.CbNamespace_Form) || (step.Input != "" && step.Input != c.FormInput_Text) {
+			return "", wrongInput(step)
+		}
+		return cbData.Data, nil
+	}
+
+	//ожидалось нажатие кнопки но его не рпоизошло (нажатия reply кнопок приходят текстом)
+	if fw.expectsCallback(step) {
+		return "", invalid("Выберите вариант кнопкой")
+	}
+
+	msg := upd.Message
+	switch step.Input {
+	case c.FormInput_Photo, c.FormInput_Document:
+		return fw.readFile(userID, step, msg)
+
+	case c.FormInput_Contact:
+		if msg.Contact == nil {
+			return "", wrongInput(step)
+		}
+		if step.OwnContact && msg.Contact.UserID != msg.From.ID {
+			return "", invalid("Отправьте свой контакт")
+		}
+		return msg.Contact.PhoneNumber, nil
+
+	case c.FormInput_Location:
+		if msg.Location == nil {
+			return "", wrongInput(step)
+		}
+		body, _ := json.Marshal(map[string]float64{"lat": msg.Location.Latitude, "lon": msg.Location.Longitude})
+		return string(body), nil
+	}
+
+	if msg.Text == "" {
+		return "", wrongInput(step)
+	}
+	if step.Validation != nil {
+		check, err := fw.validators.Build(*step.Validation)
+		if err != nil {
+			return "", fmt.Errorf("некорректная проверка этапа %s: %w", step.Field, err)
+		}
+		if err := check(msg.Text); err != nil {
+			return "", err
+		}
+	}
+	return msg.Text, nil
+}
+
+// readFile file_id вложения или ключ в хранилище медиа если этап сохраняет файлы
+func (fw *FormWorker) readFile(userID int64, step c.FormStage, msg *tgbotapi.Message) (string, error) {
+	file := m.MessageMedia(msg)
+	if file == nil || file.Kind != string(step.Input) {
+		return "", wrongInput(step)
+	}
+
+	if step.MaxSize > 0 && file.Size > step.MaxSize {
+		return "", invalid("Файл слишком большой, максимум %d КБ", step.MaxSize/1024)
+	}
+	if len(step.Mime) > 0 && !slices.Contains(step.Mime, file.MimeType) {
+		return "", invalid("Неподходящий тип файла")
+	}
+
+	if !step.Save {
+		return file.FileId, nil
+	}
+
+	if fw.media == nil {
+		return "", fmt.Errorf("этап %s: хранилище медиа не настроено", step.Field)
+	}
+
+	saved, err := media.Fetch(fw.media, fw.bot, file.FileId, media.Meta{
+		FileUniqueId: file.FileUniqueId,
+		FileName:     file.FileName,
+		Mime:         file.MimeType,
+		SenderId:     userID,
+		ChatId:       msg.Chat.ID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла формы: %w", err)
+	}
+
+	return saved.Key, nil
+}
+
+func invalid(format string, args ...any) error {
+	return &validation.Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// wrongInput подсказка что ожидает этап
+func wrongInput(step c.FormStage) error {
+	switch step.Input {
+	case c.FormInput_Photo:
+		return invalid("Пришлите фото")
+	case c.FormInput_Document:
+		return invalid("Пришлите файл")
+	case c.FormInput_Contact:
+		return invalid("Отправьте контакт кнопкой ниже")
+	case c.FormInput_Location:
+		return invalid("Отправьте геопозицию кнопкой ниже")
+	case c.FormInput_Choice:
+		return invalid("Выберите вариант кнопкой")
+	}
+	return invalid("Введите ответ текстом")
+}
+
+// handleChoice отмечает варианты в сессии, ok=true когда выбор завершен, значение - json список
+func (fw *FormWorker) handleChoice(sess *FormSession, form *c.Form, query *tgbotapi.CallbackQuery, cbData l.LuaCbData) (string, bool) {
+	step := form.Stages[sess.Step]
+	if query == nil || query.Message == nil {
+		fw.sendValidationError(sess, step, wrongInput(step))
+		return "", false
+	}
+
+	namespace, action, ok := b.ParseNamespacedScript(cbData.Script)
+	if !ok || namespace != b.CbNamespace_Form {
+		return "", false
+	}
+
+	selected := sess.Choice
+
+	switch action {
+	case formActionPick:
+		if !slices.ContainsFunc(step.Options, func(o c.FormOption) bool { return o.Value == cbData.Data }) {
+			return "", false
+		}
+
+		// одиночный выбор завершается сразу
+		if step.MaxChoices == 1 {
+			selected = []string{cbData.Data}
+			break
+		}
+
+		if i := slices.Index(selected, cbData.Data); i >= 0 {
+			selected = slices.Delete(selected, i, i+1)
+		} else {
+			if step.MaxChoices > 0 && len(selected) >= step.MaxChoices {
+				fw.bot.AnswerCallback(query.ID, fmt.Sprintf("можно выбрать не больше %d", step.MaxChoices), false)
+				return "", false
+			}
+			selected = append(selected, cbData.Data)
+		}
+
+		sess.Choice = selected
+
+		mesh := choiceKeyboard(step, selected)
+		// кнопки отмены и возврата остаются под вариантами
+		if row := controlRow(form, len(sess.History) > 0, step.Optional); len(row) > 0 {
+			mesh.Rows = append(mesh.Rows, row)
+		}
+		if err := fw.bot.EditMarkup(query.Message.Chat.ID, query.Message.MessageID, &mesh); err != nil {
+			logrus.Debugf("ошибка обновления вариантов: %v", err)
+		}
+		return "", false
+
+	case formActionDone:
+		if min := max(step.MinChoices, 1); len(selected) < min {
+			fw.bot.AnswerCallback(query.ID, fmt.Sprintf("выберите хотя бы %d", min), false)
+			return "", false
+		}
+
+	default:
+		return "", false
+	}
+
+	sess.Choice = nil
+	if err := fw.bot.EditMarkup(query.Message.Chat.ID, query.Message.MessageID, nil); err != nil {
+		logrus.Debugf("ошибка удаления вариантов: %v", err)
+	}
+
+	// значения в порядке вариантов, а не нажатий
+	values := make([]string, 0, len(selected))
+	for _, o := range step.Options {
+		if slices.Contains(selected, o.Value) {
+			values = append(values, o.Value)
+		}
+	}
+	body, _ := json.Marshal(values)
+	return string(body), true
+}
+
+// choiceKeyboard варианты этапа с отметками выбранных, сообщение не удаляется при нажатии
+func choiceKeyboard(step c.FormStage, selected []string) b.MeshInlineKeyboard {
+	var mesh b.MeshInlineKeyboard
+	keep := string(c.PressMode_Keep)
+
+	for _, o := range step.Options {
+		text := o.Text
+		if slices.Contains(selected, o.Value) {
+			text = "✅ " + text
+		}
+		mesh.Rows = append(mesh.Rows, []b.MeshInlineButton{{
+			Text:         text,
+			Script:       b.NamespacedScript(b.CbNamespace_Form, formActionPick),
+			CustomCbData: o.Value,
+			OnPress:      keep,
+		}})
+	}
+
+	if step.MaxChoices != 1 {
+		mesh.Rows = append(mesh.Rows, []b.MeshInlineButton{{
+			Text:    "Готово",
+			Script:  b.NamespacedScript(b.CbNamespace_Form, formActionDone),
+			OnPress: keep,
+		}})
+	}
+
+	return mesh
+}
+
+// stageKeyboard клавиатура по типу ввода если своя у этапа не задана
+func stageKeyboard(step c.FormStage) b.Markup {
+	switch step.Input {
+	case c.FormInput_Choice:
+		return choiceKeyboard(step, nil)
+	case c.FormInput_Contact:
+		return b.MeshReplyKeyboard{Resize: true, OneTime: true,
+			Rows: [][]b.MeshReplyButton{{{Text: "📱 Отправить контакт", RequestContact: true}}}}
+	case c.FormInput_Location:
+		return b.MeshReplyKeyboard{Resize: true, OneTime: true,
+			Rows: [][]b.MeshReplyButton{{{Text: "📍 Отправить геопозицию", RequestLocation: true}}}}
+	}
+	return nil
+}
+
+// decodeValue геопозиция и выбор хранятся в буфере json, в ctx.form_data попадают таблицей
+func decodeValue(stage c.FormStage, raw string) interface{} {
+	switch stage.Input {
+	case c.FormInput_Location, c.FormInput_Choice:
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err == nil {
+			return v
+		}
+	}
+	return raw
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"testing"
+
+	b "github.com/end1essrage/indigo-core/bot"
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	"github.com/end1essrage/indigo-core/validation"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestReadInput(t *testing.T) {
+	fw := &FormWorker{config: &c.Config{Keyboards: map[string]*c.Keyboard{}}, validators: validation.NewRegistry(nil)}
+	user := &tgbotapi.User{ID: 1}
+	chat := &tgbotapi.Chat{ID: 1}
+	msg := func(mutate func(*tgbotapi.Message)) *tgbotapi.Update {
+		m := &tgbotapi.Message{From: user, Chat: chat}
+		mutate(m)
+		return &tgbotapi.Update{Message: m}
+	}
+
+	testCases := []struct {
+		name  string
+		step  c.FormStage
+		upd   *tgbotapi.Update
+		cb    l.LuaCbData
+		want  string
+		valid bool
+	}{
+		{
+			name:  "text",
+			step:  c.FormStage{Field: "name"},
+			upd:   msg(func(m *tgbotapi.Message) { m.Text = "Вася" }),
+			want:  "Вася",
+			valid: true,
+		},
+		{
+			name:  "text with failed validation",
+			step:  c.FormStage{Field: "age", Validation: &map[string]any{"type": "number", "min": uint64(14)}},
+			upd:   msg(func(m *tgbotapi.Message) { m.Text = "12" }),
+			valid: false,
+		},
+		{
+			name:  "photo instead of text",
+			step:  c.FormStage{Field: "name"},
+			upd:   msg(func(m *tgbotapi.Message) { m.Photo = []tgbotapi.PhotoSize{{FileID: "p"}} }),
+			valid: false,
+		},
+		{
+			name: "photo",
+			step: c.FormStage{Field: "pic", Input: c.FormInput_Photo},
+			upd: msg(func(m *tgbotapi.Message) {
+				m.Photo = []tgbotapi.PhotoSize{{FileID: "small"}, {FileID: "big", FileSize: 10}}
+			}),
+			want:  "big",
+			valid: true,
+		},
+		{
+			name:  "photo too large",
+			step:  c.FormStage{Field: "pic", Input: c.FormInput_Photo, MaxSize: 5},
+			upd:   msg(func(m *tgbotapi.Message) { m.Photo = []tgbotapi.PhotoSize{{FileID: "big", FileSize: 10}} }),
+			valid: false,
+		},
+		{
+			name:  "document with wrong mime",
+			step:  c.FormStage{Field: "doc", Input: c.FormInput_Document, Mime: []string{"application/pdf"}},
+			upd:   msg(func(m *tgbotapi.Message) { m.Document = &tgbotapi.Document{FileID: "d", MimeType: "image/png"} }),
+			valid: false,
+		},
+		{
+			name:  "own contact",
+			step:  c.FormStage{Field: "phone", Input: c.FormInput_Contact, OwnContact: true},
+			upd:   msg(func(m *tgbotapi.Message) { m.Contact = &tgbotapi.Contact{PhoneNumber: "+7900", UserID: 1} }),
+			want:  "+7900",
+			valid: true,
+		},
+		{
+			name:  "foreign contact",
+			step:  c.FormStage{Field: "phone", Input: c.FormInput_Contact, OwnContact: true},
+			upd:   msg(func(m *tgbotapi.Message) { m.Contact = &tgbotapi.Contact{PhoneNumber: "+7900", UserID: 2} }),
+			valid: false,
+		},
+		{
+			name:  "location",
+			step:  c.FormStage{Field: "geo", Input: c.FormInput_Location},
+			upd:   msg(func(m *tgbotapi.Message) { m.Location = &tgbotapi.Location{Latitude: 55.5, Longitude: 37.5} }),
+			want:  `{"lat":55.5,"lon":37.5}`,
+			valid: true,
+		},
+		{
+			name:  "stale choice button on text stage",
+			step:  c.FormStage{Field: "name"},
+			upd:   &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user}},
+			cb:    l.LuaCbData{Script: b.NamespacedScript(b.CbNamespace_Form, formActionPick), Data: "a"},
+			valid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := fw.readInput(1, tc.step, tc.upd, tc.cb)
+			if (err == nil) != tc.valid {
+				t.Fatalf("err = %v, want valid %v", err, tc.valid)
+			}
+			if err == nil && got != tc.want {
+				t.Errorf("value = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChoiceKeyboard(t *testing.T) {
+	step := c.FormStage{Input: c.FormInput_Choice, Options: []c.FormOption{{Text: "A", Value: "a"}, {Text: "B", Value: "b"}}}
+
+	mesh := choiceKeyboard(step, []string{"b"})
+	if len(mesh.Rows) != 3 {
+		t.Fatalf("expected options and done row, got %d rows", len(mesh.Rows))
+	}
+	if mesh.Rows[0][0].Text != "A" || mesh.Rows[1][0].Text != "✅ B" {
+		t.Errorf("unexpected marks %+v", mesh.Rows)
+	}
+
+	step.MaxChoices = 1
+	if mesh := choiceKeyboard(step, nil); len(mesh.Rows) != 2 {
+		t.Errorf("single choice should not have done button, got %d rows", len(mesh.Rows))
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	choice := decodeValue(c.FormStage{Input: c.FormInput_Choice}, `["a","b"]`)
+	if list, ok := choice.([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("choice should decode to list, got %#v", choice)
+	}
+
+	geo := decodeValue(c.FormStage{Input: c.FormInput_Location}, `{"lat":1,"lon":2}`)
+	if m, ok := geo.(map[string]interface{}); !ok || m["lon"] != 2.0 {
+		t.Errorf("location should decode to table, got %#v", geo)
+	}
+
+	if v := decodeValue(c.FormStage{}, `["text"]`); v != `["text"]` {
+		t.Errorf("text should stay as is, got %#v", v)
+	}
+}
@@ -1,247 +1,385 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
+	"sync"
+	"time"
 
 	b "github.com/end1essrage/indigo-core/bot"
 	c "github.com/end1essrage/indigo-core/config"
 	l "github.com/end1essrage/indigo-core/lua"
 	m "github.com/end1essrage/indigo-core/mapper"
+	"github.com/end1essrage/indigo-core/media"
+	"github.com/end1essrage/indigo-core/validation"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
 //Добавить описание
-//Возможность сбрасывать форму и канселить контекст дергая очистку
-//создать буффер с методами для генерации ключей форм, так в едином месте можно будет увидеть все ключи с которыми работаем
-//в основе буфера будет инмемори
-
 //сейчас все крепится на юзер айди, формы в глобал чатах стоит запретить
 
-// Надо улучшить механиз удаления сообщений, записывая их в буфер, стоит создать временные сообщения и сообщения этапа
+// Надо улучшить механиз удаления сообщений: id сообщений формы уже копятся в сессии,
 // например ошибки валидации надо удалять после переввода пользователем, вопросы наверное тоже стоит удалять автоматически
-type Buffer interface {
-	GetString(key string) string
-	SetString(key string, val string) error
-	Exists(key string) bool
+
+// FormCallback обработчик завершения внутренней формы, вызывается вместо скрипта
+type FormCallback func(userID int64, data map[string]interface{})
+
+// internalForm форма объявленная в го коде (админ меню и т.п.)
+type internalForm struct {
+	form       *c.Form
+	onComplete FormCallback
 }
 
+// число блокировок пользователей, память не растет с числом пользователей
+const userLockStripes = 64
+
 type FormWorker struct {
-	bot    *b.TgBot
-	buffer Buffer
-	config *c.Config
-	le     *l.LuaEngine
+	bot      *b.TgBot
+	sessions SessionStore
+	config   *c.Config
+	// конфиг подменяется при перезагрузке, таймеры читают его из своих горутин
+	cfgMu    sync.RWMutex
+	le       *l.LuaEngine
+	media    media.Store
+	internal map[string]internalForm
+	// таймеры бездействия по пользователям
+	timers map[int64]*time.Timer
+	mu     sync.Mutex
+	// ввод, старт и таймаут формы одного пользователя не пересекаются, блокировки разбиты по id
+	userLocks [userLockStripes]sync.Mutex
+	// проверки текстового ввода этапов
+	validators *validation.Registry
 }
 
-func NewFormWorker(bot *b.TgBot, buffer Buffer, config *c.Config, le *l.LuaEngine) *FormWorker {
+func NewFormWorker(bot *b.TgBot, sessions SessionStore, config *c.Config, le *l.LuaEngine, store media.Store) *FormWorker {
 	return &FormWorker{
-		bot:    bot,
-		buffer: buffer,
-		config: config,
-		le:     le,
+		bot:      bot,
+		sessions: sessions,
+		config:   config,
+		le:       le,
+		media:    store,
+		internal: make(map[string]internalForm),
+		timers:   make(map[int64]*time.Timer),
+		// луа проверка получает значение в ctx.text и возвращает true или текст ошибки
+		validators: validation.NewRegistry(func(script, value string) (interface{}, error) {
+			return le.ExecuteScriptWithResult(script, l.LuaContext{MessageText: value})
+		}),
 	}
 }
 
-func (fw *FormWorker) HasActiveForm(upd *tgbotapi.Update) bool {
-	if upd.Message != nil {
-		return fw.buffer.Exists(fw.formKey(upd.Message.From.ID))
+// SetConfig подменяет конфиг после перезагрузки, начатые формы продолжаются по новой версии
+func (fw *FormWorker) SetConfig(config *c.Config) {
+	fw.cfgMu.Lock()
+	fw.config = config
+	fw.cfgMu.Unlock()
+}
+
+func (fw *FormWorker) cfg() *c.Config {
+	fw.cfgMu.RLock()
+	defer fw.cfgMu.RUnlock()
+	return fw.config
+}
+
+// lockUser блокировка сессии пользователя, возвращает разблокировку
+func (fw *FormWorker) lockUser(userID int64) func() {
+	mu := &fw.userLocks[uint64(userID)%userLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// RegisterForm регистрирует внутреннюю форму, по завершении вызывается onComplete
+func (fw *FormWorker) RegisterForm(form *c.Form, onComplete FormCallback) {
+	fw.internal[form.Name] = internalForm{form: form, onComplete: onComplete}
+}
+
+// getForm ищет форму среди внутренних и объявленных в конфиге
+func (fw *FormWorker) getForm(name string) *c.Form {
+	if f, ok := fw.internal[name]; ok {
+		return f.form
 	}
-	if upd.CallbackQuery != nil {
-		return fw.buffer.Exists(fw.formKey(upd.CallbackQuery.From.ID))
+	return fw.cfg().Forms[name]
+}
+
+func (fw *FormWorker) HasActiveForm(upd *tgbotapi.Update) bool {
+	switch {
+	case upd.Message != nil:
+		return fw.session(upd.Message.From.ID) != nil
+	case upd.CallbackQuery != nil:
+		return fw.session(upd.CallbackQuery.From.ID) != nil
 	}
 	return false
 }
 
+// session активная форма пользователя, nil если ее нет
+func (fw *FormWorker) session(userID int64) *FormSession {
+	sess, err := fw.sessions.Get(userID)
+	if err != nil {
+		logrus.Errorf("ошибка чтения сессии формы %d: %v", userID, err)
+		return nil
+	}
+	return sess
+}
+
+func (fw *FormWorker) saveSession(sess *FormSession) {
+	if err := fw.sessions.Save(sess); err != nil {
+		logrus.Errorf("ошибка сохранения сессии формы %d: %v", sess.UserId, err)
+	}
+}
+
 func (fw *FormWorker) StartForm(formName string, userID int64, upd *tgbotapi.Update) error {
-	logrus.Debug("satretd form")
-	form := fw.config.Forms[formName]
+	return fw.StartFormWithData(formName, userID, upd, nil)
+}
+
+// StartFormWithData запускает форму с заранее известными полями (например id редактируемой сущности)
+func (fw *FormWorker) StartFormWithData(formName string, userID int64, upd *tgbotapi.Update, initial map[string]string) error {
+	logrus.Debugf("старт формы %s пользователем %d", formName, userID)
+	defer fw.lockUser(userID)()
+
+	form := fw.getForm(formName)
 	if form == nil {
 		return fmt.Errorf("form '%s' not found", formName)
 	}
 
-	// проставляем какая у пользователя активная форма
-	fw.buffer.SetString(fw.formKey(userID), formName)
-	// проставляем какая у пользователя активная форма и ее прогресс
-	fw.buffer.SetString(fw.progressKey(userID), "0")
+	sess := NewFormSession(userID, formName)
+	for field, val := range initial {
+		sess.Answers[field] = val
+		sess.Extra = append(sess.Extra, field)
+	}
+	fw.touch(sess, form)
 
-	return fw.sendFormStep(userID, 0, upd)
+	// первые этапы могут быть скрыты условием по заранее известным полям
+	sess.Step = fw.showable(sess, form, 0, upd)
+	if sess.Step >= len(form.Stages) {
+		fw.completeForm(sess, form, upd)
+		return nil
+	}
+
+	return fw.sendFormStep(sess, form, upd)
 }
 
-// вот тут надо захендлить остановку формы
 func (fw *FormWorker) HandleInput(upd *tgbotapi.Update) {
 	var userID int64
-	var input string
+	var cbData l.LuaCbData
 
 	switch {
 	case upd.Message != nil:
 		userID = upd.Message.From.ID
-		input = upd.Message.Text
 	case upd.CallbackQuery != nil:
 		userID = upd.CallbackQuery.From.ID
-		input = m.FromCallbackDataToLuaCbData(upd.CallbackQuery.Data).Data
+		cbData = m.FromCallbackDataToLuaCbData(upd.CallbackQuery.Data)
 
-		// удаляем сообщение если это было нажатие кнопки
-		fw.bot.DeleteMsg(upd.CallbackQuery.Message.Chat.ID, upd.CallbackQuery.Message.MessageID)
+		// удаляем сообщение если это было нажатие кнопки (или по on_press кнопки)
+		fw.bot.ApplyPress(upd.CallbackQuery, cbData.OnPress)
 	default:
 		return
 	}
 
-	formName := fw.buffer.GetString(fw.formKey(userID))
-	if formName == "" {
+	defer fw.lockUser(userID)()
+	sess := fw.session(userID)
+	if sess == nil {
 		return
 	}
 
-	progress, _ := strconv.Atoi(fw.buffer.GetString(fw.progressKey(userID)))
-	form := fw.config.Forms[formName]
-
-	if progress >= len(form.Stages) {
+	form := fw.getForm(sess.Form)
+	if form == nil || sess.Step >= len(form.Stages) {
 		fw.clearFormData(userID)
 		return
 	}
 
-	currentStep := form.Stages[progress]
+	if expired(sess) {
+		fw.timeoutForm(sess, form)
+		return
+	}
+	fw.touch(sess, form)
+
+	currentStep := form.Stages[sess.Step]
 
-	//ожидалось нажатие кнопки но его не рпоизошло
-	if currentStep.Keyboard != nil && upd.CallbackQuery == nil {
-		fw.sendValidationError(userID)
+	switch action := controlAction(form, upd, cbData); {
+	case action == formActionCancel:
+		fw.cancelForm(sess, form, upd)
+		return
+	case action == formActionBack:
+		fw.stepBack(sess, form, upd)
+		return
+	case action == formActionSkip && currentStep.Optional:
+		delete(sess.Answers, currentStep.Field)
+		sess.Choice = nil
+		fw.advance(sess, form, upd)
 		return
 	}
 
-	if upd.Message != nil && input != "" {
-		if currentStep.Validation != nil && !fw.validateInput(*currentStep.Validation, input) {
-			fw.sendValidationError(userID)
+	var input string
+	if currentStep.Input == c.FormInput_Choice {
+		// варианты переключаются кнопками, этап завершается когда выбор сделан
+		var ok bool
+		if input, ok = fw.handleChoice(sess, form, upd.CallbackQuery, cbData); !ok {
+			fw.saveSession(sess)
 			return
 		}
-	}
-
-	fw.saveFormData(userID, currentStep.Field, input)
-
-	if progress < len(form.Stages)-1 {
-		fw.buffer.SetString(fw.progressKey(userID), strconv.Itoa(progress+1))
-		fw.sendFormStep(userID, progress+1, upd)
 	} else {
-		fw.completeForm(userID, form, upd)
+		var err error
+		if input, err = fw.readInput(userID, currentStep, upd, cbData); err != nil {
+			fw.rejectInput(sess, form, currentStep, upd, err)
+			return
+		}
 	}
+
+	sess.Answers[currentStep.Field] = input
+	fw.advance(sess, form, upd)
 }
 
-func (fw *FormWorker) sendFormStep(userID int64, stepIndex int, upd *tgbotapi.Update) error {
-	formName := fw.buffer.GetString(fw.formKey(userID))
-	form := fw.config.Forms[formName]
-	step := form.Stages[stepIndex]
+// sendFormStep задает вопрос текущего этапа сессии и сохраняет ее
+func (fw *FormWorker) sendFormStep(sess *FormSession, form *c.Form, upd *tgbotapi.Update) error {
+	step := form.Stages[sess.Step]
+	// попытки считаются для каждого этапа отдельно
+	sess.Attempts = 0
+	sess.Choice = nil
+	defer fw.saveSession(sess)
 
-	msg := tgbotapi.NewMessage(userID, step.Message)
+	var markup b.Markup
 
 	// Handle keyboard
 	if step.Keyboard != nil && *step.Keyboard != "" {
-		kb := fw.config.Keyboards[*step.Keyboard]
+		kb := fw.cfg().Keyboards[*step.Keyboard]
 		if kb == nil {
 			return fmt.Errorf("keyboard '%s' not found", *step.Keyboard)
 		}
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			b.CreateInlineKeyboard(b.ParseInlineKeyboard(kb))...,
-		)
-		msg.ReplyMarkup = &keyboard
+		markup = b.ParseKeyboard(kb)
+	} else {
+		markup = stageKeyboard(step)
 	}
+	markup = withControls(markup, form, len(sess.History) > 0, step.Optional)
 
 	// Execute step script
 	if step.Script != nil && *step.Script != "" {
-		ctx := m.FromTgUpdateToLuaContext(upd)
-		ctx.FormData = fw.collectFormData(userID)
+		ctx := l.LuaContext{ChatId: sess.UserId, FromId: sess.UserId}
+		if upd != nil {
+			ctx = m.FromTgUpdateToLuaContext(upd)
+		}
+		ctx.FormData = fw.collectFormData(sess)
 		if err := fw.le.ExecuteScript(*step.Script, ctx); err != nil {
 			logrus.Errorf("Form step script error: %v", err)
 		}
 	}
 
-	err := fw.bot.Send(msg)
-	return err
+	// длинные клавиатуры этапа листаются как обычные
+	return fw.send(sess, step.Message, markup)
 }
 
-func (fw *FormWorker) completeForm(userID int64, form *c.Form, upd *tgbotapi.Update) {
-	data := fw.collectFormData(userID)
+// send сообщение формы, id запоминается в сессии
+func (fw *FormWorker) send(sess *FormSession, text string, markup b.Markup) error {
+	msgId, err := fw.bot.SendOpts(sess.UserId, text, markup, b.SendOptions{})
+	if err != nil {
+		return err
+	}
+	sess.MessageIds = append(sess.MessageIds, msgId)
+	return nil
+}
 
-	// Execute completion script
-	if form.Script != "" {
-		var ctx l.LuaContext
+// expectsCallback этап ждет нажатия inline кнопки
+func (fw *FormWorker) expectsCallback(step c.FormStage) bool {
+	if step.Input == c.FormInput_Choice {
+		return true
+	}
+	if step.Keyboard == nil {
+		return false
+	}
+	kb := fw.cfg().Keyboards[*step.Keyboard]
+	return kb == nil || !kb.IsReply()
+}
 
-		if upd.CallbackQuery != nil {
-			ctx = m.FromCallbackQueryToLuaContext(upd.CallbackQuery)
-		} else {
-			ctx = m.FromTgUpdateToLuaContext(upd)
-		}
+func (fw *FormWorker) completeForm(sess *FormSession, form *c.Form, upd *tgbotapi.Update) {
+	data := fw.collectFormData(sess)
+	fw.clearFormData(sess.UserId)
 
+	// внутренние формы завершаются го кодом
+	if f, ok := fw.internal[form.Name]; ok {
+		f.onComplete(sess.UserId, data)
+		return
+	}
+
+	// Execute completion script
+	if form.Script != "" {
+		ctx := updateContext(upd)
 		ctx.FormData = data
 		if err := fw.le.ExecuteScript(form.Script, ctx); err != nil {
 			logrus.Errorf("Form completion script error: %v", err)
 		}
 	}
-
-	fw.clearFormData(userID)
 }
 
-func (fw *FormWorker) validateInput(rules map[string]any, value string) bool {
-	if rules == nil {
-		return true
-	}
-
-	switch rules["type"].(string) {
-	case "string":
-		if min, ok := rules["min_length"].(int); ok {
-			return len(value) >= min
-		}
-	case "email":
-		return strings.Contains(value, "@") && strings.Contains(value, ".")
-	case "number":
-		_, err := strconv.ParseFloat(value, 64)
-		return err == nil
-	case "regex":
-		if pattern, ok := rules["pattern"].(string); ok {
-			matched, _ := regexp.MatchString(pattern, value)
-			return matched
-		}
+// updateContext контекст скрипта из сообщения или нажатия
+func updateContext(upd *tgbotapi.Update) l.LuaContext {
+	if upd.CallbackQuery != nil {
+		return m.FromCallbackQueryToLuaContext(upd.CallbackQuery)
 	}
-	return true
+	return m.FromTgUpdateToLuaContext(upd)
 }
 
-func (fw *FormWorker) sendValidationError(userID int64) {
-	msg := tgbotapi.NewMessage(userID, "Validation error")
-	fw.bot.Send(msg)
-}
+// sendValidationError свой текст этапа, иначе сообщение проверки
+func (fw *FormWorker) sendValidationError(sess *FormSession, step c.FormStage, err error) {
+	text := defaultErrorMessage
+	var vErr *validation.Error
+	switch {
+	case step.Error != nil:
+		text = *step.Error
+	case errors.As(err, &vErr):
+		text = vErr.Message
+	}
 
-// Helper methods
-func (fw *FormWorker) formKey(userID int64) string {
-	return fmt.Sprintf("form:%d", userID)
+	if vErr == nil {
+		logrus.Warnf("ошибка ввода на этапе %s: %v", step.Field, err)
+	}
+	if err := fw.send(sess, text, nil); err != nil {
+		logrus.Errorf("ошибка отправки сообщения об ошибке ввода: %v", err)
+	}
 }
 
-func (fw *FormWorker) progressKey(userID int64) string {
-	return fmt.Sprintf("form_progress:%d", userID)
-}
+// rejectInput сообщает об ошибке, после max_attempts неудачных попыток форма отменяется
+func (fw *FormWorker) rejectInput(sess *FormSession, form *c.Form, step c.FormStage, upd *tgbotapi.Update, err error) {
+	limit := step.MaxAttempts
+	if limit == 0 {
+		limit = form.MaxAttempts
+	}
 
-func (fw *FormWorker) dataKey(userID int64, field string) string {
-	return fmt.Sprintf("form_data:%d:%s", userID, field)
-}
+	sess.Attempts++
+	if limit > 0 && sess.Attempts >= limit {
+		fw.abortForm(sess, form, upd, attemptsExceededMessage)
+		return
+	}
 
-func (fw *FormWorker) saveFormData(userID int64, field, value string) {
-	fw.buffer.SetString(fw.dataKey(userID, field), value)
+	fw.sendValidationError(sess, step, err)
+	fw.saveSession(sess)
 }
 
-func (fw *FormWorker) collectFormData(userID int64) map[string]interface{} {
+// collectFormData ответы для ctx.form_data, выбор и геопозиция раскладываются в таблицы
+func (fw *FormWorker) collectFormData(sess *FormSession) map[string]interface{} {
 	data := make(map[string]interface{})
-	formName := fw.buffer.GetString(fw.formKey(userID))
-	form := fw.config.Forms[formName]
+	form := fw.getForm(sess.Form)
+	if form == nil {
+		return data
+	}
 
 	for _, stage := range form.Stages {
-		if val := fw.buffer.GetString(fw.dataKey(userID, stage.Field)); val != "" {
-			data[stage.Field] = val
+		if val, ok := sess.Answers[stage.Field]; ok {
+			data[stage.Field] = decodeValue(stage, val)
+		}
+	}
+
+	for _, field := range sess.Extra {
+		if val, ok := sess.Answers[field]; ok {
+			data[field] = val
 		}
 	}
 	return data
 }
 
+// clearFormData удаляет сессию целиком вместе с ответами
 func (fw *FormWorker) clearFormData(userID int64) {
-	fw.buffer.SetString(fw.formKey(userID), "")
-	fw.buffer.SetString(fw.progressKey(userID), "")
+	if err := fw.sessions.Delete(userID); err != nil {
+		logrus.Errorf("ошибка удаления сессии формы %d: %v", userID, err)
+	}
+	fw.stopTimer(userID)
 }
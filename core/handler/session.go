@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+const (
+	// незавершенная форма живет сутки если в конфиге не задано иное
+	DefaultSessionTTL = 24 * time.Hour
+
+	sessionKeyPrefix         = "form_session:"
+	defaultSessionCollection = "form_sessions"
+)
+
+// FormSession прогресс формы пользователя, хранится одной записью
+type FormSession struct {
+	UserId int64  `json:"user_id"`
+	Form   string `json:"form"`
+	// индекс текущего этапа
+	Step int `json:"step"`
+	// ответы по полям, выбор и геопозиция - json
+	Answers map[string]string `json:"answers"`
+	// поля переданные при старте формы, а не собранные этапами
+	Extra []string `json:"extra,omitempty"`
+	// пройденные этапы, по ним работает возврат назад
+	History []int `json:"history,omitempty"`
+	// отмеченные варианты текущего этапа выбора
+	Choice []string `json:"choice,omitempty"`
+	// неудачные попытки ввода на текущем этапе
+	Attempts int `json:"attempts,omitempty"`
+	// время (unix ms) после которого форма сбрасывается, 0 - без таймаута
+	Deadline int64 `json:"deadline,omitempty"`
+	// сообщения бота отправленные по ходу формы
+	MessageIds []int     `json:"message_ids,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+func NewFormSession(userID int64, form string) *FormSession {
+	return &FormSession{UserId: userID, Form: form, Answers: make(map[string]string), StartedAt: time.Now()}
+}
+
+// SessionStore хранилище прогресса форм, Get возвращает nil если формы нет
+type SessionStore interface {
+	Get(userID int64) (*FormSession, error)
+	Save(s *FormSession) error
+	Delete(userID int64) error
+}
+
+// SessionCache кэш бота (в памяти или redis)
+type SessionCache interface {
+	GetString(key string) string
+	SetStringTTL(key string, val string, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// CacheSessions сессии в кэше, с redis переживают перезапуск и общие для реплик
+type CacheSessions struct {
+	cache SessionCache
+	ttl   time.Duration
+}
+
+func NewCacheSessions(cache SessionCache, ttl time.Duration) *CacheSessions {
+	return &CacheSessions{cache: cache, ttl: ttl}
+}
+
+func (s *CacheSessions) Get(userID int64) (*FormSession, error) {
+	body := s.cache.GetString(sessionKey(userID))
+	if body == "" {
+		return nil, nil
+	}
+
+	var sess FormSession
+	if err := json.Unmarshal([]byte(body), &sess); err != nil {
+		return nil, fmt.Errorf("поврежденная сессия формы %d: %w", userID, err)
+	}
+	return &sess, nil
+}
+
+func (s *CacheSessions) Save(sess *FormSession) error {
+	body, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.cache.SetStringTTL(sessionKey(sess.UserId), string(body), s.ttl)
+}
+
+func (s *CacheSessions) Delete(userID int64) error {
+	return s.cache.Delete(sessionKey(userID))
+}
+
+func sessionKey(userID int64) string {
+	return fmt.Sprintf("%s%d", sessionKeyPrefix, userID)
+}
+
+// StorageSessions сессии в хранилище (файлы или mongo), просроченные удаляются при чтении
+type StorageSessions struct {
+	storage    storage.Storage
+	collection string
+	ttl        time.Duration
+}
+
+func NewStorageSessions(st storage.Storage, ttl time.Duration) *StorageSessions {
+	return &StorageSessions{storage: st, collection: defaultSessionCollection, ttl: ttl}
+}
+
+func (s *StorageSessions) Get(userID int64) (*FormSession, error) {
+	entity, err := s.storage.GetOne(context.TODO(), s.collection, sessionQuery(userID))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if expires, ok := entity["expires_at"].(float64); ok && time.Now().Unix() > int64(expires) {
+		return nil, s.Delete(userID)
+	}
+
+	body, _ := entity["session"].(string)
+	var sess FormSession
+	if err := json.Unmarshal([]byte(body), &sess); err != nil {
+		return nil, fmt.Errorf("поврежденная сессия формы %d: %w", userID, err)
+	}
+	return &sess, nil
+}
+
+// Save сессия лежит json строкой, чтобы ответы не зависели от схемы хранилища
+func (s *StorageSessions) Save(sess *FormSession) error {
+	body, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	entity := storage.NewEntity()
+	entity["session"] = string(body)
+	entity["expires_at"] = float64(time.Now().Add(s.ttl).Unix())
+
+	ctx := context.TODO()
+	updated, err := s.storage.Update(ctx, s.collection, sessionQuery(sess.UserId), entity)
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); !ok {
+			return err
+		}
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	entity["user_id"] = float64(sess.UserId)
+	_, err = s.storage.Create(ctx, s.collection, entity)
+	return err
+}
+
+func (s *StorageSessions) Delete(userID int64) error {
+	_, err := s.storage.Delete(context.TODO(), s.collection, sessionQuery(userID))
+	if _, ok := err.(*storage.NotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+func sessionQuery(userID int64) storage.QueryNode {
+	return &storage.Condition{Field: "user_id", Operator: "=", Value: float64(userID)}
+}
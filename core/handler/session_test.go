@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/cache"
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+func TestSessionStores(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	memory := cache.NewInMemoryCache(time.Minute)
+	defer memory.Stop()
+
+	stores := map[string]SessionStore{
+		"cache":   NewCacheSessions(memory, time.Hour),
+		"storage": NewStorageSessions(st, time.Hour),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if sess, err := store.Get(1); err != nil || sess != nil {
+				t.Fatalf("expected no session, got %+v %v", sess, err)
+			}
+
+			sess := NewFormSession(1, "order")
+			sess.Answers["name"] = "Вася"
+			sess.History = []int{0}
+			sess.MessageIds = []int{10, 11}
+			if err := store.Save(sess); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			// повторное сохранение обновляет ту же запись
+			sess.Step = 2
+			if err := store.Save(sess); err != nil {
+				t.Fatalf("second Save failed: %v", err)
+			}
+
+			got, err := store.Get(1)
+			if err != nil || got == nil {
+				t.Fatalf("Get failed: %+v %v", got, err)
+			}
+			if got.Form != "order" || got.Step != 2 || got.Answers["name"] != "Вася" || len(got.MessageIds) != 2 || got.StartedAt.IsZero() {
+				t.Errorf("unexpected session %+v", got)
+			}
+
+			if err := store.Delete(1); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if sess, _ := store.Get(1); sess != nil {
+				t.Errorf("session should be deleted with all answers, got %+v", sess)
+			}
+		})
+	}
+}
+
+func TestStorageSessionExpires(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	store := NewStorageSessions(st, -time.Minute)
+	if err := store.Save(NewFormSession(1, "order")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if sess, err := store.Get(1); err != nil || sess != nil {
+		t.Errorf("expired session should not be returned, got %+v %v", sess, err)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const stateKeyPrefix = "state:"
+
+// DialogState состояние диалога пользователя в чате, задается из луа через state_set
+type DialogState struct {
+	// имя состояния из секции states конфига
+	Name string `json:"name"`
+	// произвольные данные скрипта
+	Data      map[string]interface{} `json:"data,omitempty"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// StateStore состояния диалогов в кэше, ключ - пара чат/пользователь
+type StateStore struct {
+	cache SessionCache
+	ttl   time.Duration
+}
+
+func NewStateStore(cache SessionCache, ttl time.Duration) *StateStore {
+	return &StateStore{cache: cache, ttl: ttl}
+}
+
+// Get имя и данные состояния пользователя в чате, пустое имя - состояния нет
+func (s *StateStore) Get(chatID, userID int64) (string, map[string]interface{}, error) {
+	body := s.cache.GetString(stateKey(chatID, userID))
+	if body == "" {
+		return "", nil, nil
+	}
+
+	var st DialogState
+	if err := json.Unmarshal([]byte(body), &st); err != nil {
+		return "", nil, fmt.Errorf("поврежденное состояние %d/%d: %w", chatID, userID, err)
+	}
+	return st.Name, st.Data, nil
+}
+
+func (s *StateStore) Set(chatID, userID int64, name string, data map[string]interface{}) error {
+	body, err := json.Marshal(DialogState{Name: name, Data: data, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return s.cache.SetStringTTL(stateKey(chatID, userID), string(body), s.ttl)
+}
+
+func (s *StateStore) Clear(chatID, userID int64) error {
+	return s.cache.Delete(stateKey(chatID, userID))
+}
+
+func stateKey(chatID, userID int64) string {
+	return fmt.Sprintf("%s%d:%d", stateKeyPrefix, chatID, userID)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/cache"
+)
+
+func TestStateStore(t *testing.T) {
+	memory := cache.NewInMemoryCache(time.Minute)
+	defer memory.Stop()
+	store := NewStateStore(memory, time.Hour)
+
+	if name, _, err := store.Get(-100, 1); err != nil || name != "" {
+		t.Fatalf("expected no state, got %q %v", name, err)
+	}
+
+	if err := store.Set(-100, 1, "ask_city", map[string]interface{}{"age": float64(30)}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	name, data, err := store.Get(-100, 1)
+	if err != nil || name != "ask_city" || data["age"] != float64(30) {
+		t.Fatalf("unexpected state %q %v %v", name, data, err)
+	}
+
+	// состояние привязано к паре чат/пользователь
+	if name, _, _ := store.Get(1, 1); name != "" {
+		t.Errorf("state leaked to private chat: %q", name)
+	}
+	if name, _, _ := store.Get(-100, 2); name != "" {
+		t.Errorf("state leaked to other user: %q", name)
+	}
+
+	if err := store.Clear(-100, 1); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if name, _, _ := store.Get(-100, 1); name != "" {
+		t.Errorf("state not cleared: %q", name)
+	}
+}
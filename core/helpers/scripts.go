@@ -1,20 +1,32 @@
 package helpers
 
 import (
+	"bytes"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
 )
 
 type Scripts struct {
-	Data     map[string][]byte // Путь -> содержимое файла
+	Data map[string][]byte // Путь -> содержимое файла
+	// скомпилированные при загрузке скрипты, компилируются один раз и выполняются в любом стейте
+	Protos map[string]*lua.FunctionProto
+	// скрипты с синтаксическими ошибками, ошибка возвращается при запуске
+	Errors   map[string]error
 	rootPath string
 }
 
 func NewScripts(rootPath string) (*Scripts, error) {
 	fw := &Scripts{
 		Data:     make(map[string][]byte),
+		Protos:   make(map[string]*lua.FunctionProto),
+		Errors:   make(map[string]error),
 		rootPath: rootPath,
 	}
 
@@ -56,5 +68,27 @@ func (fw *Scripts) loadFile(fullPath string) error {
 	key := strings.Split(path, ".")[0]
 
 	fw.Data[key] = content
+
+	proto, err := Compile(content, key)
+	if err != nil {
+		logrus.Errorf("ошибка компиляции скрипта %s: %v", key, err)
+		fw.Errors[key] = err
+		return nil
+	}
+	fw.Protos[key] = proto
 	return nil
 }
+
+// Compile разбирает и компилирует луа код в прото, которое можно выполнять многократно
+func Compile(code []byte, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(bytes.NewReader(code), name)
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return proto, nil
+}
@@ -1,27 +1,134 @@
 package interceptor
 
 import (
+	"fmt"
+	"strings"
+
+	l "github.com/end1essrage/indigo-core/lua"
+	m "github.com/end1essrage/indigo-core/mapper"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/sirupsen/logrus"
 )
 
+// Verdict решение перехватчика о дальнейшей обработке обновления
+type Verdict string
+
+const (
+	// обработка продолжается без изменений
+	Verdict_Continue Verdict = "continue"
+	// обработка прерывается, команды и кнопки не запускаются
+	Verdict_Stop Verdict = "stop"
+	// перехватчик изменил текст/данные, обработка продолжается
+	Verdict_Rewrite Verdict = "rewrite"
+)
+
+// Context общий для всей цепочки перехватчиков одного обновления
+type Context struct {
+	Update *tgbotapi.Update
+	// данные которыми перехватчики обогащают ctx (ctx.data в луа)
+	Data map[string]interface{}
+}
+
+func NewContext(upd *tgbotapi.Update) *Context {
+	return &Context{Update: upd, Data: make(map[string]interface{})}
+}
+
 type Interceptor struct {
-	useFunc func(upd *tgbotapi.Update) error
+	useFunc func(ctx *Context) (Verdict, error)
 }
 
-func New(f func(upd *tgbotapi.Update) error) Interceptor {
+func New(f func(ctx *Context) (Verdict, error)) Interceptor {
 	return Interceptor{useFunc: f}
 }
 
-func (i Interceptor) Use(upd *tgbotapi.Update) error {
-	return i.useFunc(upd)
+func (i Interceptor) Use(ctx *Context) (Verdict, error) {
+	return i.useFunc(ctx)
 }
 
-func Script(scriptPath string) Interceptor {
-	useFunc := func(upd *tgbotapi.Update) error {
-		logrus.Warningf("script run")
-		return nil
+/*
+Script перехватчик на луа, скрипт сообщает вердикт через return:
+
+	return "stop"                      -- прервать обработку
+	return false                       -- то же самое
+	return nil / true / "continue"     -- продолжить
+	return {verdict = "rewrite", text = "/start", data = {role = "vip"}}
+*/
+func Script(le *l.LuaEngine, scriptPath string) Interceptor {
+	useFunc := func(ctx *Context) (Verdict, error) {
+		lCtx := m.FromUpdateToLuaContext(ctx.Update)
+		lCtx.Data = ctx.Data
+
+		result, err := le.ExecuteScriptWithResult(scriptPath, lCtx)
+		if err != nil {
+			return Verdict_Continue, err
+		}
+
+		return applyResult(ctx, result)
 	}
 
 	return Interceptor{useFunc: useFunc}
 }
+
+func applyResult(ctx *Context, result interface{}) (Verdict, error) {
+	switch r := result.(type) {
+	case nil:
+		return Verdict_Continue, nil
+	case bool:
+		if !r {
+			return Verdict_Stop, nil
+		}
+		return Verdict_Continue, nil
+	case string:
+		return parseVerdict(r)
+	case map[string]interface{}:
+		verdict := Verdict_Rewrite
+		if v, ok := r["verdict"].(string); ok {
+			parsed, err := parseVerdict(v)
+			if err != nil {
+				return Verdict_Continue, err
+			}
+			verdict = parsed
+		}
+
+		if verdict != Verdict_Rewrite {
+			return verdict, nil
+		}
+
+		if data, ok := r["data"].(map[string]interface{}); ok {
+			for k, v := range data {
+				ctx.Data[k] = v
+			}
+		}
+
+		if text, ok := r["text"].(string); ok {
+			rewriteText(ctx.Update, text)
+		}
+
+		return Verdict_Rewrite, nil
+	}
+
+	return Verdict_Continue, fmt.Errorf("unsupported interceptor result %T", result)
+}
+
+func parseVerdict(v string) (Verdict, error) {
+	switch Verdict(v) {
+	case Verdict_Continue, Verdict_Stop, Verdict_Rewrite:
+		return Verdict(v), nil
+	}
+	return Verdict_Continue, fmt.Errorf("unknown verdict %s", v)
+}
+
+// rewriteText подменяет текст сообщения, пересобирая признак команды
+func rewriteText(upd *tgbotapi.Update, text string) {
+	msg := m.UpdateMessage(upd)
+	if msg == nil || upd.CallbackQuery != nil {
+		return
+	}
+
+	msg.Text = text
+	msg.Entities = nil
+
+	if strings.HasPrefix(text, "/") {
+		length := len([]rune(strings.SplitN(text, " ", 2)[0]))
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+}
@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestApplyResult(t *testing.T) {
+	testCases := []struct {
+		name    string
+		result  interface{}
+		want    Verdict
+		wantErr bool
+	}{
+		{name: "nil", result: nil, want: Verdict_Continue},
+		{name: "true", result: true, want: Verdict_Continue},
+		{name: "false", result: false, want: Verdict_Stop},
+		{name: "stop", result: "stop", want: Verdict_Stop},
+		{name: "continue", result: "continue", want: Verdict_Continue},
+		{name: "rewrite string", result: "rewrite", want: Verdict_Rewrite},
+		{name: "table with text", result: map[string]interface{}{"text": "/start"}, want: Verdict_Rewrite},
+		{name: "table with stop", result: map[string]interface{}{"verdict": "stop", "text": "/start"}, want: Verdict_Stop},
+		{name: "unknown verdict", result: "drop", want: Verdict_Continue, wantErr: true},
+		{name: "unknown verdict in table", result: map[string]interface{}{"verdict": "drop"}, want: Verdict_Continue, wantErr: true},
+		{name: "unsupported type", result: float64(1), want: Verdict_Continue, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := applyResult(NewContext(textUpdate("hello")), tc.result)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("verdict = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyResultRewrite(t *testing.T) {
+	ctx := NewContext(textUpdate("hello"))
+	ctx.Data["checked"] = true
+
+	verdict, err := applyResult(ctx, map[string]interface{}{
+		"verdict": "rewrite",
+		"text":    "/ban@my_bot 42 spam",
+		"data":    map[string]interface{}{"role": "vip"},
+	})
+	if err != nil || verdict != Verdict_Rewrite {
+		t.Fatalf("verdict = %s, err = %v", verdict, err)
+	}
+
+	// данные дополняют, а не заменяют ctx.data
+	if ctx.Data["checked"] != true || ctx.Data["role"] != "vip" {
+		t.Errorf("data not merged: %v", ctx.Data)
+	}
+
+	msg := ctx.Update.Message
+	if msg.Text != "/ban@my_bot 42 spam" {
+		t.Errorf("text = %q", msg.Text)
+	}
+	if len(msg.Entities) != 1 || msg.Entities[0].Type != "bot_command" || msg.Entities[0].Offset != 0 || msg.Entities[0].Length != 11 {
+		t.Fatalf("command entity not rebuilt: %+v", msg.Entities)
+	}
+	if !msg.IsCommand() || msg.Command() != "ban" || msg.CommandArguments() != "42 spam" {
+		t.Errorf("command = %q, args = %q", msg.Command(), msg.CommandArguments())
+	}
+}
+
+func TestRewriteText(t *testing.T) {
+	// команда переписана в обычный текст - старые entities убираются
+	upd := textUpdate("/start", tgbotapi.MessageEntity{Type: "bot_command", Offset: 0, Length: 6})
+	rewriteText(upd, "привет")
+	if upd.Message.IsCommand() || len(upd.Message.Entities) != 0 {
+		t.Errorf("stale command entity: %+v", upd.Message.Entities)
+	}
+
+	// длина команды считается в символах
+	upd = textUpdate("hi")
+	rewriteText(upd, "/старт аргумент")
+	if e := upd.Message.Entities; len(e) != 1 || e[0].Length != 6 {
+		t.Errorf("entity = %+v", e)
+	}
+
+	// нажатия кнопок не переписываются
+	cb := &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "x", Message: &tgbotapi.Message{Text: "menu"}}}
+	rewriteText(cb, "/start")
+	if cb.CallbackQuery.Message.Text != "menu" {
+		t.Error("callback message should not be rewritten")
+	}
+}
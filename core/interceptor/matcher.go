@@ -0,0 +1,113 @@
+package interceptor
+
+import (
+	"fmt"
+	"regexp"
+
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	m "github.com/end1essrage/indigo-core/mapper"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Matcher решает затрагивает ли обновление группу перехватчиков
+type Matcher func(upd *tgbotapi.Update) bool
+
+var urlRegex = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// NewMatcher собирает матчер под режим из конфига
+func NewMatcher(le *l.LuaEngine, cfg c.Interceptor) (Matcher, error) {
+	switch cfg.Affects {
+	case c.AffectMode_All:
+		return func(upd *tgbotapi.Update) bool { return true }, nil
+	case c.AffectMode_Commands:
+		return isCommand, nil
+	case c.AffectMode_Text:
+		return isText, nil
+	case c.AffectMode_Buttons:
+		return func(upd *tgbotapi.Update) bool { return upd.CallbackQuery != nil }, nil
+	case c.AffectMode_Media:
+		return isMedia, nil
+	case c.AffectMode_Url:
+		return hasUrl, nil
+	case c.AffectMode_Regex:
+		if cfg.Pattern == nil {
+			return nil, fmt.Errorf("не задан pattern для режима regex")
+		}
+		re, err := regexp.Compile(*cfg.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(upd *tgbotapi.Update) bool {
+			text, ok := messageText(upd)
+			return ok && re.MatchString(text)
+		}, nil
+	case c.AffectMode_Filter:
+		if cfg.Filter == nil {
+			return nil, fmt.Errorf("не задан filter для режима filter")
+		}
+		expr := *cfg.Filter
+		return func(upd *tgbotapi.Update) bool {
+			ok, err := le.EvalExpression(expr, m.FromUpdateToLuaContext(upd))
+			if err != nil {
+				logrus.Errorf("ошибка фильтра перехватчика: %v", err)
+				return false
+			}
+			return ok
+		}, nil
+	}
+
+	return nil, fmt.Errorf("неизвестный режим %s", cfg.Affects)
+}
+
+func isCommand(upd *tgbotapi.Update) bool {
+	msg := m.UpdateMessage(upd)
+	return upd.CallbackQuery == nil && msg != nil && msg.IsCommand()
+}
+
+func isText(upd *tgbotapi.Update) bool {
+	msg := m.UpdateMessage(upd)
+	return upd.CallbackQuery == nil && msg != nil && msg.Text != "" && !msg.IsCommand()
+}
+
+func isMedia(upd *tgbotapi.Update) bool {
+	msg := m.UpdateMessage(upd)
+	if upd.CallbackQuery != nil || msg == nil {
+		return false
+	}
+
+	return len(msg.Photo) > 0 || msg.Document != nil || msg.Audio != nil || msg.Video != nil ||
+		msg.Voice != nil || msg.VideoNote != nil || msg.Animation != nil || msg.Sticker != nil
+}
+
+func hasUrl(upd *tgbotapi.Update) bool {
+	msg := m.UpdateMessage(upd)
+	if upd.CallbackQuery != nil || msg == nil {
+		return false
+	}
+
+	// тг сам размечает ссылки в тексте и подписи
+	for _, entities := range [][]tgbotapi.MessageEntity{msg.Entities, msg.CaptionEntities} {
+		for _, e := range entities {
+			if e.Type == "url" || e.Type == "text_link" {
+				return true
+			}
+		}
+	}
+
+	text, _ := messageText(upd)
+	return urlRegex.MatchString(text)
+}
+
+// messageText текст сообщения или подпись к медиа
+func messageText(upd *tgbotapi.Update) (string, bool) {
+	msg := m.UpdateMessage(upd)
+	if upd.CallbackQuery != nil || msg == nil {
+		return "", false
+	}
+	if msg.Text != "" {
+		return msg.Text, true
+	}
+	return msg.Caption, msg.Caption != ""
+}
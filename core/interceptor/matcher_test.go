@@ -0,0 +1,103 @@
+package interceptor
+
+import (
+	"testing"
+
+	c "github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func textUpdate(text string, entities ...tgbotapi.MessageEntity) *tgbotapi.Update {
+	return &tgbotapi.Update{Message: &tgbotapi.Message{
+		Text:     text,
+		Chat:     &tgbotapi.Chat{ID: 1, Type: "private"},
+		Entities: entities,
+	}}
+}
+
+func TestMatchers(t *testing.T) {
+	pattern := `^\d+$`
+
+	command := textUpdate("/start", tgbotapi.MessageEntity{Type: "bot_command", Offset: 0, Length: 6})
+	text := textUpdate("hello")
+	digits := textUpdate("12345")
+	link := textUpdate("see example.com", tgbotapi.MessageEntity{Type: "url", Offset: 4, Length: 11})
+	rawLink := textUpdate("go https://example.com now")
+	callback := &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "x"}}
+	photo := &tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:    &tgbotapi.Chat{ID: 1},
+		Photo:   []tgbotapi.PhotoSize{{FileID: "f"}},
+		Caption: "777",
+	}}
+	post := &tgbotapi.Update{ChannelPost: &tgbotapi.Message{Text: "news", Chat: &tgbotapi.Chat{ID: -1, Type: "channel"}}}
+	member := &tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{}}
+
+	testCases := []struct {
+		name  string
+		cfg   c.Interceptor
+		match []*tgbotapi.Update
+		skip  []*tgbotapi.Update
+	}{
+		{
+			name:  "all",
+			cfg:   c.Interceptor{Affects: c.AffectMode_All},
+			match: []*tgbotapi.Update{command, text, callback, photo, post, member},
+		},
+		{
+			name:  "commands",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Commands},
+			match: []*tgbotapi.Update{command},
+			skip:  []*tgbotapi.Update{text, callback, photo, member},
+		},
+		{
+			name:  "text",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Text},
+			match: []*tgbotapi.Update{text, post},
+			skip:  []*tgbotapi.Update{command, callback, photo, member},
+		},
+		{
+			name:  "buttons",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Buttons},
+			match: []*tgbotapi.Update{callback},
+			skip:  []*tgbotapi.Update{command, text, photo, member},
+		},
+		{
+			name:  "media",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Media},
+			match: []*tgbotapi.Update{photo},
+			skip:  []*tgbotapi.Update{command, text, callback, member},
+		},
+		{
+			name:  "regex",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Regex, Pattern: &pattern},
+			match: []*tgbotapi.Update{digits, photo},
+			skip:  []*tgbotapi.Update{text, callback, member},
+		},
+		{
+			name:  "url",
+			cfg:   c.Interceptor{Affects: c.AffectMode_Url},
+			match: []*tgbotapi.Update{link, rawLink},
+			skip:  []*tgbotapi.Update{text, callback, member},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matcher, err := NewMatcher(nil, tc.cfg)
+			if err != nil {
+				t.Fatalf("NewMatcher failed: %v", err)
+			}
+
+			for i, upd := range tc.match {
+				if !matcher(upd) {
+					t.Errorf("update #%d should match", i)
+				}
+			}
+			for i, upd := range tc.skip {
+				if matcher(upd) {
+					t.Errorf("update #%d should not match", i)
+				}
+			}
+		})
+	}
+}
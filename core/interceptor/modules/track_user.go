@@ -1,15 +1,52 @@
 package interceptor
 
 import (
+	"github.com/end1essrage/indigo-core/config"
 	i "github.com/end1essrage/indigo-core/interceptor"
+	"github.com/end1essrage/indigo-core/service"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
-func TrackUser() i.Interceptor {
-	useFunc := func(upd *tgbotapi.Update) error {
-		logrus.Warningf("track user")
-		return nil
+type UserTracker interface {
+	TrackUser(user *tgbotapi.User, counter string) error
+}
+
+/*
+TrackUser сохраняет профиль пользователя в хранилище
+
+	modules:
+	  - name: "track_user"
+	    cfg:
+	      collection: "users"  # коллекция для профилей
+	      counters: "false"    # не считать сообщения и нажатия
+*/
+func TrackUser(tracker UserTracker, cfg *config.ModuleConfig) i.Interceptor {
+	counters := true
+	if cfg != nil && cfg.Cfg["counters"] == "false" {
+		counters = false
+	}
+
+	useFunc := func(ctx *i.Context) (i.Verdict, error) {
+		user := ctx.Update.SentFrom()
+		//посты в каналах приходят без отправителя
+		if user == nil {
+			return i.Verdict_Continue, nil
+		}
+
+		counter := ""
+		if counters {
+			counter = service.UserCounter_Messages
+			if ctx.Update.CallbackQuery != nil {
+				counter = service.UserCounter_Callbacks
+			}
+		}
+
+		if err := tracker.TrackUser(user, counter); err != nil {
+			logrus.Errorf("ошибка сохранения пользователя %d: %v", user.ID, err)
+		}
+
+		return i.Verdict_Continue, nil
 	}
 
 	return i.New(useFunc)
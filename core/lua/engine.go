@@ -3,16 +3,24 @@ package lua
 import (
 	"context"
 	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/end1essrage/indigo-core/helpers"
 	h "github.com/end1essrage/indigo-core/lua/helpers"
 	m "github.com/end1essrage/indigo-core/lua/modules"
+	"github.com/end1essrage/indigo-core/media"
 	"github.com/end1essrage/indigo-core/secret"
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
 )
 
+// размер пула стейтов, столько скриптов выполняется без создания нового стейта
+var defaultPoolSize = 2 * runtime.NumCPU()
+
 // Lua engine wrapper
 type LuaEngine struct {
 	bot      m.Bot
@@ -20,33 +28,150 @@ type LuaEngine struct {
 	service  m.Service
 	http     m.HttpClient
 	storage  m.Storage
+	media    media.Store
+	states   m.States
 	BasePath string
 	Secret   *secret.SecretsOperator
-	scripts  map[string][]byte
+	scripts  map[string]*lua.FunctionProto
+	// скрипты которые не скомпилировались при загрузке
+	broken map[string]error
+	// скомпилированные выражения фильтров и условий из конфига
+	exprs sync.Map
+	pool  *statePool
+	mu    sync.RWMutex
 }
 
-func NewLuaEngine(b m.Bot, c m.Cache, h m.HttpClient, s m.Storage, path string, sec *secret.SecretsOperator, svc m.Service) *LuaEngine {
-	engine := &LuaEngine{bot: b, cache: c, http: h, storage: s, BasePath: path, Secret: sec, service: svc}
+func NewLuaEngine(b m.Bot, c m.Cache, h m.HttpClient, s m.Storage, path string, sec *secret.SecretsOperator, svc m.Service, ms media.Store, st m.States) *LuaEngine {
+	engine := &LuaEngine{bot: b, cache: c, http: h, storage: s, BasePath: path, Secret: sec, service: svc, media: ms, states: st}
 	spy, err := helpers.NewScripts(path)
 	if err != nil {
 		logrus.Fatalf("ошибка загрузки скриптов %v", err)
 	}
 
-	engine.scripts = spy.Data
+	engine.scripts = spy.Protos
+	engine.broken = spy.Errors
+	engine.pool = newStatePool(defaultPoolSize, engine.newState)
 	return engine
 }
 
-func (le *LuaEngine) ExecuteScript(scriptPath string, lContext LuaContext) error {
-	logrus.Infof("ExecuteScript path:%s", scriptPath)
-
-	L := NewStateBuilder(le).
+// newState стейт с модулями, не зависящими от обновления
+func (le *LuaEngine) newState() *lua.LState {
+	return NewStateBuilder(le).
 		WithModule(m.NewCache(le.cache)).
 		WithModule(m.NewBot(le.bot, le.service)).
 		WithModule(m.NewHttp(le.http)).
 		WithModule(m.NewStorage(le.storage)).
+		WithModule(m.NewUsers(le.service)).
+		WithModule(m.NewMedia(le.media, le.bot)).
 		Build()
+}
+
+func (le *LuaEngine) ExecuteScript(scriptPath string, lContext LuaContext) error {
+	_, err := le.ExecuteScriptWithResult(scriptPath, lContext)
+	return err
+}
+
+// ExecuteScriptWithResult выполняет скрипт и возвращает значение, которое вернул чанк (return ...)
+func (le *LuaEngine) ExecuteScriptWithResult(scriptPath string, lContext LuaContext) (interface{}, error) {
+	logrus.Infof("ExecuteScript path:%s", scriptPath)
+
+	le.mu.RLock()
+	proto, ok := le.scripts[scriptPath]
+	broken := le.broken[scriptPath]
+	le.mu.RUnlock()
+	if broken != nil {
+		return nil, fmt.Errorf("lua error: %v", broken)
+	}
+	if !ok {
+		return nil, fmt.Errorf("script didnt found %s", scriptPath)
+	}
+
+	return le.execute(proto, lContext)
+}
+
+// ReloadScripts перечитывает скрипты с диска, при ошибке остаются старые
+func (le *LuaEngine) ReloadScripts() (int, error) {
+	spy, err := le.LoadScripts()
+	if err != nil {
+		return 0, err
+	}
+
+	le.SetScripts(spy)
+	return len(spy.Data), nil
+}
+
+// LoadScripts читает и компилирует скрипты не трогая текущие, ошибка если хоть один не скомпилировался
+func (le *LuaEngine) LoadScripts() (*helpers.Scripts, error) {
+	spy, err := helpers.NewScripts(le.BasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(spy.Errors) > 0 {
+		broken := make([]string, 0, len(spy.Errors))
+		for key, err := range spy.Errors {
+			broken = append(broken, fmt.Sprintf("%s: %v", key, err))
+		}
+		sort.Strings(broken)
+		return nil, fmt.Errorf("ошибки компиляции скриптов: %s", strings.Join(broken, "; "))
+	}
+	return spy, nil
+}
+
+// SetScripts подменяет скрипты загруженные через LoadScripts
+func (le *LuaEngine) SetScripts(spy *helpers.Scripts) {
+	le.mu.Lock()
+	le.scripts = spy.Protos
+	le.broken = spy.Errors
+	le.mu.Unlock()
+}
+
+// EvalExpression вычисляет луа выражение (или код с return) в контексте апдейта
+func (le *LuaEngine) EvalExpression(expr string, lContext LuaContext) (bool, error) {
+	proto, err := le.compileExpression(expr)
+	if err != nil {
+		return false, fmt.Errorf("lua error: %v", err)
+	}
+
+	result, err := le.execute(proto, lContext)
+	if err != nil {
+		return false, err
+	}
+
+	// как в луа: ложны только nil и false
+	if b, ok := result.(bool); ok {
+		return b, nil
+	}
+	return result != nil, nil
+}
+
+// compileExpression выражения берутся из конфига, поэтому кэш не растет бесконечно
+func (le *LuaEngine) compileExpression(expr string) (*lua.FunctionProto, error) {
+	if proto, ok := le.exprs.Load(expr); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
+
+	code := strings.TrimSpace(expr)
+	if !strings.HasPrefix(code, "return") {
+		code = "return (" + code + ")"
+	}
+
+	proto, err := helpers.Compile([]byte(code), "<expr>")
+	if err != nil {
+		return nil, err
+	}
+	le.exprs.Store(expr, proto)
+	return proto, nil
+}
+
+func (le *LuaEngine) execute(proto *lua.FunctionProto, lContext LuaContext) (result interface{}, err error) {
+	ps := le.pool.get()
+	defer func() { le.pool.put(ps, err != nil) }()
+	L := ps.L
 
-	defer L.Close()
+	// модули зависящие от обновления, при возврате в пул убираются
+	m.NewState(le.states, lContext.ChatId, lContext.FromId).Apply(L)
+	le.applyRequire(L)
 
 	//заполняем контекст
 	setLuaContext(L, &lContext)
@@ -58,15 +183,17 @@ func (le *LuaEngine) ExecuteScript(scriptPath string, lContext LuaContext) error
 	L.SetContext(ctx)
 
 	// Выполняем скрипт
-	if _, ok := le.scripts[scriptPath]; ok {
-		if err := L.DoString(string(le.scripts[scriptPath])); err != nil {
-			return fmt.Errorf("lua error: %v", err)
-		}
-	} else {
-		return fmt.Errorf("script didnt found %s", scriptPath)
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		return nil, fmt.Errorf("lua error: %v", err)
+	}
+
+	// возвращенное значение остается на стеке
+	if L.GetTop() == 0 {
+		return nil, nil
 	}
 
-	return nil
+	return h.ConvertLuaValue(L.Get(-1)), nil
 }
 
 func setLuaContext(L *lua.LState, lContext *LuaContext) {
@@ -75,6 +202,10 @@ func setLuaContext(L *lua.LState, lContext *LuaContext) {
 	// Базовые поля
 	L.SetField(data, "chat_id", lua.LNumber(lContext.ChatId))
 	L.SetField(data, "text", lua.LString(lContext.MessageText))
+	L.SetField(data, "message_id", lua.LNumber(lContext.MessageId))
+	if lContext.CallbackId != "" {
+		L.SetField(data, "callback_id", lua.LString(lContext.CallbackId))
+	}
 
 	// Обработка callback данных
 	cbData := L.NewTable()
@@ -94,6 +225,52 @@ func setLuaContext(L *lua.LState, lContext *LuaContext) {
 		L.SetField(data, "req_data", reqDataTable)
 	}
 
+	// Данные от перехватчиков
+	if lContext.Data != nil {
+		L.SetField(data, "data", h.ConvertToLuaTable(L, lContext.Data))
+	}
+
+	// Контакт и геопозиция от reply кнопок
+	if lContext.Contact != nil {
+		contact := L.NewTable()
+		L.SetField(contact, "phone", lua.LString(lContext.Contact.Phone))
+		L.SetField(contact, "first_name", lua.LString(lContext.Contact.FirstName))
+		L.SetField(contact, "last_name", lua.LString(lContext.Contact.LastName))
+		L.SetField(contact, "user_id", lua.LNumber(lContext.Contact.UserId))
+		L.SetField(data, "contact", contact)
+	}
+	if lContext.Location != nil {
+		location := L.NewTable()
+		L.SetField(location, "lat", lua.LNumber(lContext.Location.Lat))
+		L.SetField(location, "lon", lua.LNumber(lContext.Location.Lon))
+		L.SetField(data, "location", location)
+	}
+
+	// Вложение сообщения
+	if lContext.Media != nil {
+		media := L.NewTable()
+		L.SetField(media, "type", lua.LString(lContext.Media.Kind))
+		L.SetField(media, "file_id", lua.LString(lContext.Media.FileId))
+		L.SetField(media, "file_unique_id", lua.LString(lContext.Media.FileUniqueId))
+		L.SetField(media, "file_name", lua.LString(lContext.Media.FileName))
+		L.SetField(media, "mime", lua.LString(lContext.Media.MimeType))
+		L.SetField(media, "size", lua.LNumber(lContext.Media.Size))
+		L.SetField(media, "width", lua.LNumber(lContext.Media.Width))
+		L.SetField(media, "height", lua.LNumber(lContext.Media.Height))
+		L.SetField(media, "duration", lua.LNumber(lContext.Media.Duration))
+		L.SetField(media, "caption", lua.LString(lContext.Media.Caption))
+		L.SetField(media, "group_id", lua.LString(lContext.Media.GroupId))
+		L.SetField(data, "media", media)
+	}
+
+	// Состояние диалога, по которому пришло сообщение
+	if lContext.State != nil {
+		state := L.NewTable()
+		L.SetField(state, "name", lua.LString(lContext.State.Name))
+		L.SetField(state, "data", h.ConvertToLuaTable(L, lContext.State.Data))
+		L.SetField(data, "state", state)
+	}
+
 	// Информация о пользователе
 	user := L.NewTable()
 	L.SetField(user, "id", lua.LNumber(lContext.FromId))
@@ -0,0 +1,121 @@
+package lua
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	m "github.com/end1essrage/indigo-core/lua/modules"
+)
+
+// скрипт обычного обработчика: разбор данных, таблицы, строки
+const benchScript = `
+local data = json_decode('{"items": [1, 2, 3, 4, 5], "name": "order"}')
+local sum = 0
+for _, v in ipairs(data.items) do
+	sum = sum + v
+end
+local parts = {}
+for i = 1, 10 do
+	parts[#parts + 1] = ctx.user.name .. ":" .. i
+end
+return table.concat(parts, ",") .. sum
+`
+
+// ExecuteFresh - как раньше: новый стейт со всеми модулями и разбор исходника на каждый вызов
+func (le *LuaEngine) ExecuteFresh(code string, lContext LuaContext) error {
+	L := NewStateBuilder(le).
+		WithModule(m.NewCache(le.cache)).
+		WithModule(m.NewBot(le.bot, le.service)).
+		WithModule(m.NewHttp(le.http)).
+		WithModule(m.NewStorage(le.storage)).
+		WithModule(m.NewUsers(le.service)).
+		WithModule(m.NewMedia(le.media, le.bot)).
+		WithModule(m.NewState(le.states, lContext.ChatId, lContext.FromId)).
+		Build()
+	defer L.Close()
+
+	setLuaContext(L, &lContext)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	L.SetContext(ctx)
+
+	return L.DoString(code)
+}
+
+func setupBenchmarkEngine(tb testing.TB) *LuaEngine {
+	dir := tb.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bench.lua"), []byte(benchScript), 0644); err != nil {
+		tb.Fatalf("write script: %v", err)
+	}
+	return NewLuaEngine(nil, nil, nil, nil, dir, nil, nil, nil, nil)
+}
+
+var benchContext = LuaContext{ChatId: 1, FromId: 1, FromName: "bench", MessageText: "/start"}
+
+func BenchmarkExecute_Fresh(b *testing.B) {
+	le := setupBenchmarkEngine(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := le.ExecuteFresh(benchScript, benchContext); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecute_Pooled(b *testing.B) {
+	le := setupBenchmarkEngine(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := le.ExecuteScriptWithResult("bench", benchContext); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecute_Fresh_Parallel(b *testing.B) {
+	le := setupBenchmarkEngine(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := le.ExecuteFresh(benchScript, benchContext); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkExecute_Pooled_Parallel(b *testing.B) {
+	le := setupBenchmarkEngine(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := le.ExecuteScriptWithResult("bench", benchContext); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEvalExpression(b *testing.B) {
+	le := setupBenchmarkEngine(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := le.EvalExpression("ctx.user.id == 1", benchContext); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,15 +1,28 @@
 package lua_modules
 
 import (
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
 
 	b "github.com/end1essrage/indigo-core/bot"
+	c "github.com/end1essrage/indigo-core/config"
 )
 
 type Bot interface {
 	SendMessage(chatId int64, text string) error
 	SendKeyboard(chatId int64, text string, mesh b.MeshInlineKeyboard) error
+	SendOpts(chatId int64, text string, kb b.Markup, opts b.SendOptions) (int, error)
+	SendMedia(chatId int64, kind c.MediaKind, src b.MediaSource, caption string, kb b.Markup, opts b.SendOptions) (int, error)
+	SendAlbum(chatId int64, items []b.MediaItem, opts b.SendOptions) ([]int, error)
+	DownloadFile(fileId string) (io.ReadCloser, error)
+	EditText(chatId int64, msgId int, text string, mesh *b.MeshInlineKeyboard) error
+	EditMarkup(chatId int64, msgId int, mesh *b.MeshInlineKeyboard) error
+	AnswerCallback(queryId string, text string, alert bool) error
+	DeleteMsg(chatId int64, msgId int) error
 }
 
 //можно ли схлопнуть в один метод?
@@ -33,25 +46,7 @@ func (m *BotModule) applySend(L *lua.LState, cmd string) {
 		chatID := L.CheckInt64(1)
 		text := L.CheckString(2)
 
-		if L.GetTop() >= 3 {
-			meshTable := L.CheckTable(3)
-			mesh := b.FromLuaTableToMeshInlineKeyboard(meshTable)
-
-			if err := m.bot.SendKeyboard(chatID, text, mesh); err != nil {
-				logrus.Errorf("Error sending keyboard: %v", err)
-				L.Push(lua.LString("send failed"))
-				return 1
-			}
-		} else {
-			if err := m.bot.SendMessage(chatID, text); err != nil {
-				logrus.Errorf("Error sending message: %v", err)
-				L.Push(lua.LString("send failed"))
-				return 1
-			}
-		}
-
-		L.Push(lua.LNil)
-		return 1
+		return m.send(L, chatID, text)
 	}))
 }
 
@@ -63,29 +58,227 @@ func (m *BotModule) applySendChannel(L *lua.LState, cmd string) {
 		chatID, err := m.service.GetChannelId(chanCode)
 		if err != nil {
 			logrus.Errorf("ошибка получения айди канала по коду %s", err.Error())
+			L.Push(lua.LNil)
 			L.Push(lua.LString("send failed"))
-			return 1
+			return 2
 		}
 
-		if L.GetTop() >= 3 {
-			meshTable := L.CheckTable(3)
-			mesh := b.FromLuaTableToMeshInlineKeyboard(meshTable)
+		return m.send(L, chatID, text)
+	}))
+}
 
-			if err := m.bot.SendKeyboard(chatID, text, mesh); err != nil {
-				logrus.Errorf("Error sending keyboard: %v", err)
-				L.Push(lua.LString("send failed"))
-				return 1
+// send общая часть send и send_chan: клавиатура (inline или reply) 3им аргументом, опции 4ым
+func (m *BotModule) send(L *lua.LState, chatID int64, text string) int {
+	msgID, err := m.bot.SendOpts(chatID, text, optionalMarkup(L, 3), sendOptions(L, 4))
+	if err != nil {
+		logrus.Errorf("Error sending message: %v", err)
+		L.Push(lua.LNil)
+		L.Push(lua.LString("send failed: " + err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LNumber(msgID))
+	L.Push(lua.LNil)
+	return 2
+}
+
+// sendOptions опции отправки из таблицы в аргументе n
+func sendOptions(L *lua.LState, n int) b.SendOptions {
+	var opts b.SendOptions
+
+	tbl, ok := L.Get(n).(*lua.LTable)
+	if !ok {
+		return opts
+	}
+
+	opts.ParseMode = lua.LVAsString(tbl.RawGetString("parse_mode"))
+	opts.ReplyTo = int(lua.LVAsNumber(tbl.RawGetString("reply_to")))
+	opts.Silent = lua.LVAsBool(tbl.RawGetString("silent"))
+	opts.Protect = lua.LVAsBool(tbl.RawGetString("protect"))
+	opts.NoPreview = lua.LVAsBool(tbl.RawGetString("no_preview"))
+	opts.ThreadId = int(lua.LVAsNumber(tbl.RawGetString("thread_id")))
+
+	return opts
+}
+
+func (m *BotModule) applySendMedia(L *lua.LState, cmd string, kind c.MediaKind) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		chatID := L.CheckInt64(1)
+
+		src, err := mediaSource(L.Get(2))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		var caption string
+		var kb b.Markup
+		if opts, ok := L.Get(3).(*lua.LTable); ok {
+			caption = lua.LVAsString(opts.RawGetString("caption"))
+			if tbl, ok := opts.RawGetString("keyboard").(*lua.LTable); ok {
+				kb = b.FromLuaTableToMarkup(tbl)
+			}
+		}
+
+		msgID, err := m.bot.SendMedia(chatID, kind, src, caption, kb, sendOptions(L, 3))
+		if err != nil {
+			logrus.Errorf("Error sending %s: %v", kind, err)
+			L.Push(lua.LNil)
+			L.Push(lua.LString("send failed: " + err.Error()))
+			return 2
+		}
+
+		L.Push(lua.LNumber(msgID))
+		L.Push(lua.LNil)
+		return 2
+	}))
+}
+
+func (m *BotModule) applySendAlbum(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		chatID := L.CheckInt64(1)
+		list := L.CheckTable(2)
+
+		var items []b.MediaItem
+		var parseErr error
+		list.ForEach(func(_ lua.LValue, v lua.LValue) {
+			tbl, ok := v.(*lua.LTable)
+			if !ok || parseErr != nil {
+				return
 			}
-		} else {
-			if err := m.bot.SendMessage(chatID, text); err != nil {
-				logrus.Errorf("Error sending message: %v", err)
-				L.Push(lua.LString("send failed"))
-				return 1
+
+			// источник либо полем src, либо file_id/url/key прямо в элементе
+			srcValue := tbl.RawGetString("src")
+			if srcValue == lua.LNil {
+				srcValue = tbl
 			}
+			src, err := mediaSource(srcValue)
+			if err != nil {
+				parseErr = err
+				return
+			}
+
+			items = append(items, b.MediaItem{
+				Kind:    c.MediaKind(lua.LVAsString(tbl.RawGetString("type"))),
+				Source:  src,
+				Caption: lua.LVAsString(tbl.RawGetString("caption")),
+			})
+		})
+		if parseErr != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(parseErr.Error()))
+			return 2
 		}
 
+		ids, err := m.bot.SendAlbum(chatID, items, sendOptions(L, 3))
+		if err != nil {
+			logrus.Errorf("Error sending album: %v", err)
+			L.Push(lua.LNil)
+			L.Push(lua.LString("send failed: " + err.Error()))
+			return 2
+		}
+
+		result := L.NewTable()
+		for _, id := range ids {
+			result.Append(lua.LNumber(id))
+		}
+		L.Push(result)
 		L.Push(lua.LNil)
+		return 2
+	}))
+}
+
+// mediaSource строка (file_id или ссылка) или таблица {file_id=..|url=..|key=..}
+func mediaSource(v lua.LValue) (b.MediaSource, error) {
+	switch val := v.(type) {
+	case lua.LString:
+		s := string(val)
+		if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+			return b.MediaSource{Url: s}, nil
+		}
+		return b.MediaSource{FileId: s}, nil
+	case *lua.LTable:
+		src := b.MediaSource{
+			FileId: lua.LVAsString(val.RawGetString("file_id")),
+			Url:    lua.LVAsString(val.RawGetString("url")),
+			Key:    lua.LVAsString(val.RawGetString("key")),
+		}
+		if src.FileId == "" && src.Url == "" && src.Key == "" {
+			return src, fmt.Errorf("не указан file_id, url или key")
+		}
+		return src, nil
+	}
+	return b.MediaSource{}, fmt.Errorf("некорректный источник файла")
+}
+
+// optionalKeyboard клавиатура из аргумента n, nil если не передана
+func optionalKeyboard(L *lua.LState, n int) *b.MeshInlineKeyboard {
+	if tbl, ok := L.Get(n).(*lua.LTable); ok {
+		mesh := b.FromLuaTableToMeshInlineKeyboard(tbl)
+		return &mesh
+	}
+	return nil
+}
+
+// optionalMarkup inline или reply клавиатура из аргумента n, nil если не передана
+func optionalMarkup(L *lua.LState, n int) b.Markup {
+	if tbl, ok := L.Get(n).(*lua.LTable); ok {
+		return b.FromLuaTableToMarkup(tbl)
+	}
+	return nil
+}
+
+// pushErr кладет на стек текст ошибки или nil
+func pushErr(L *lua.LState, err error) int {
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
 		return 1
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func (m *BotModule) applyEditMessage(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		chatID := L.CheckInt64(1)
+		msgID := L.CheckInt(2)
+		text := L.CheckString(3)
+
+		err := m.bot.EditText(chatID, msgID, text, optionalKeyboard(L, 4))
+		if err != nil {
+			logrus.Errorf("Error editing message: %v", err)
+		}
+		return pushErr(L, err)
+	}))
+}
+
+func (m *BotModule) applyEditKeyboard(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		chatID := L.CheckInt64(1)
+		msgID := L.CheckInt(2)
+
+		err := m.bot.EditMarkup(chatID, msgID, optionalKeyboard(L, 3))
+		if err != nil {
+			logrus.Errorf("Error editing keyboard: %v", err)
+		}
+		return pushErr(L, err)
+	}))
+}
+
+func (m *BotModule) applyAnswerCallback(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		queryID := L.CheckString(1)
+		text := L.OptString(2, "")
+		alert := L.OptBool(3, false)
+
+		return pushErr(L, m.bot.AnswerCallback(queryID, text, alert))
+	}))
+}
+
+func (m *BotModule) applyDeleteMessage(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		return pushErr(L, m.bot.DeleteMsg(L.CheckInt64(1), L.CheckInt(2)))
 	}))
 }
 
@@ -0,0 +1,96 @@
+package lua_modules
+
+import (
+	"fmt"
+
+	"github.com/end1essrage/indigo-core/media"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type MediaModule struct {
+	store media.Store
+	bot   Bot
+}
+
+func NewMedia(store media.Store, bot Bot) *MediaModule {
+	return &MediaModule{store: store, bot: bot}
+}
+
+// media_save(ctx.media | file_id) -> (key?, err?)
+func (m *MediaModule) applySave(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if m.store == nil {
+			return pushNilErr(L, fmt.Errorf("хранилище медиа не настроено"))
+		}
+
+		var fileId string
+		var meta media.Meta
+		switch v := L.Get(1).(type) {
+		case lua.LString:
+			fileId = string(v)
+		case *lua.LTable:
+			fileId = lua.LVAsString(v.RawGetString("file_id"))
+			meta.FileUniqueId = lua.LVAsString(v.RawGetString("file_unique_id"))
+			meta.FileName = lua.LVAsString(v.RawGetString("file_name"))
+			meta.Mime = lua.LVAsString(v.RawGetString("mime"))
+		}
+		if fileId == "" {
+			return pushNilErr(L, fmt.Errorf("не указан file_id"))
+		}
+
+		// отправитель и чат берутся из контекста скрипта
+		if ctx, ok := L.GetGlobal("ctx").(*lua.LTable); ok {
+			meta.ChatId = int64(lua.LVAsNumber(ctx.RawGetString("chat_id")))
+			if user, ok := ctx.RawGetString("user").(*lua.LTable); ok {
+				meta.SenderId = int64(lua.LVAsNumber(user.RawGetString("id")))
+			}
+		}
+
+		saved, err := media.Fetch(m.store, m.bot, fileId, meta)
+		if err != nil {
+			logrus.Errorf("ошибка сохранения файла %s: %v", fileId, err)
+			return pushNilErr(L, err)
+		}
+
+		L.Push(lua.LString(saved.Key))
+		L.Push(lua.LNil)
+		return 2
+	}))
+}
+
+// media_get_url(key) -> (url?, err?)
+func (m *MediaModule) applyGetUrl(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if m.store == nil {
+			return pushNilErr(L, fmt.Errorf("хранилище медиа не настроено"))
+		}
+
+		url, err := m.store.URL(L.CheckString(1))
+		if err != nil {
+			return pushNilErr(L, err)
+		}
+
+		L.Push(lua.LString(url))
+		L.Push(lua.LNil)
+		return 2
+	}))
+}
+
+// media_delete(key) -> err?
+func (m *MediaModule) applyDelete(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if m.store == nil {
+			return pushErr(L, fmt.Errorf("хранилище медиа не настроено"))
+		}
+
+		return pushErr(L, m.store.Delete(L.CheckString(1)))
+	}))
+}
+
+// pushNilErr кладет на стек nil и текст ошибки
+func pushNilErr(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
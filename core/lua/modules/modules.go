@@ -1,11 +1,17 @@
 package lua_modules
 
 import (
+	c "github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
 	lua "github.com/yuin/gopher-lua"
 )
 
 type Service interface {
 	GetChannelId(code string) (int64, error)
+	GetUser(id int64) (storage.Entity, error)
+	HasRole(userId int64, role string) (bool, error)
+	SetRole(userId int64, role string) error
+	RemoveRole(userId int64, role string) error
 }
 
 // Core
@@ -28,11 +34,36 @@ func (m *BotModule) Apply(L *lua.LState) {
 	//(chatId: int64, msg: string)
 	//m.applySendMessage(L, "send_message")
 
-	//(chatId: int64, msg: string, keyboard: table) -> err?
+	//(chatId: int64, msg: string, keyboard: table?, opts: table?) -> (msgId: int?, err?)
+	//opts: parse_mode, reply_to, silent, protect, no_preview, thread_id
 	m.applySend(L, "send")
 
-	//(chan_code: string, msg: string) -> err?
+	//(chan_code: string, msg: string, keyboard: table?, opts: table?) -> (msgId: int?, err?)
 	m.applySendChannel(L, "send_chan")
+
+	//(chatId: int64, src: string|table, opts: table?) -> (msgId: int?, err?)
+	//src: file_id, ссылка или {file_id=..|url=..|key=..}; opts: caption, keyboard и опции send
+	m.applySendMedia(L, "send_photo", c.MediaKind_Photo)
+	m.applySendMedia(L, "send_document", c.MediaKind_Document)
+	m.applySendMedia(L, "send_audio", c.MediaKind_Audio)
+	m.applySendMedia(L, "send_video", c.MediaKind_Video)
+	m.applySendMedia(L, "send_voice", c.MediaKind_Voice)
+	m.applySendMedia(L, "send_animation", c.MediaKind_Animation)
+
+	//(chatId: int64, items: {{type, src|file_id|url|key, caption}}, opts: table?) -> (msgIds: table?, err?)
+	m.applySendAlbum(L, "send_album")
+
+	//(chatId: int64, msgId: int, text: string, keyboard: table?) -> err?
+	m.applyEditMessage(L, "edit_message")
+
+	//(chatId: int64, msgId: int, keyboard: table?) -> err?, без клавиатуры - убрать
+	m.applyEditKeyboard(L, "edit_keyboard")
+
+	//(callbackId: string, text: string?, alert: bool?) -> err?
+	m.applyAnswerCallback(L, "answer_callback")
+
+	//(chatId: int64, msgId: int) -> err?
+	m.applyDeleteMessage(L, "delete_message")
 }
 
 // Storage
@@ -79,6 +110,45 @@ func (m *CacheModule) Apply(L *lua.LState) {
 	m.applySet(L, "cache_set")
 }
 
+// Users
+func (m *UsersModule) Apply(L *lua.LState) {
+	//(id: int64) -> (user: table?, err?)
+	m.applyGet(L, "users_get")
+
+	//(user_id: int64, role: string) -> bool
+	m.applyHasRole(L, "has_role")
+
+	//(user_id: int64, role: string) -> err?
+	m.applySetRole(L, "set_role")
+
+	//(user_id: int64, role: string) -> err?
+	m.applyRemoveRole(L, "remove_role")
+}
+
+// State
+func (m *StateModule) Apply(L *lua.LState) {
+	//(name: string, data: table?) -> err?, следующее сообщение уйдет скрипту состояния
+	m.applySet(L, "state_set")
+
+	//() -> (name: string?, data: table?)
+	m.applyGet(L, "state_get")
+
+	//() -> err?
+	m.applyClear(L, "state_clear")
+}
+
+// Media
+func (m *MediaModule) Apply(L *lua.LState) {
+	//(media: table|string) -> (key: string?, err?), ctx.media или file_id
+	m.applySave(L, "media_save")
+
+	//(key: string) -> (url: string?, err?)
+	m.applyGetUrl(L, "media_get_url")
+
+	//(key: string) -> err?
+	m.applyDelete(L, "media_delete")
+}
+
 // Http
 func (m *HttpModule) Apply(L *lua.LState) {
 	// (url: string, headers: table) -> (resp: table?, err?)
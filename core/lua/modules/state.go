@@ -0,0 +1,74 @@
+package lua_modules
+
+import (
+	h "github.com/end1essrage/indigo-core/lua/helpers"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// States состояния диалогов, привязаны к паре чат/пользователь
+type States interface {
+	Get(chatID, userID int64) (string, map[string]interface{}, error)
+	Set(chatID, userID int64, name string, data map[string]interface{}) error
+	Clear(chatID, userID int64) error
+}
+
+// state_set(name, data?) -> err?
+func (m *StateModule) applySet(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+
+		var data map[string]interface{}
+		if tbl := L.OptTable(2, nil); tbl != nil {
+			// пустая таблица или массив - данных нет
+			data, _ = h.ConvertLuaValue(tbl).(map[string]interface{})
+		}
+
+		if err := m.states.Set(m.chatId, m.userId, name, data); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+
+		L.Push(lua.LNil)
+		return 1
+	}))
+}
+
+// state_get() -> (name: string?, data: table?)
+func (m *StateModule) applyGet(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		name, data, err := m.states.Get(m.chatId, m.userId)
+		if err != nil || name == "" {
+			L.Push(lua.LNil)
+			L.Push(lua.LNil)
+			return 2
+		}
+
+		L.Push(lua.LString(name))
+		L.Push(h.ConvertToLuaTable(L, data))
+		return 2
+	}))
+}
+
+// state_clear() -> err?
+func (m *StateModule) applyClear(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if err := m.states.Clear(m.chatId, m.userId); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+
+		L.Push(lua.LNil)
+		return 1
+	}))
+}
+
+// StateModule работает с состоянием автора обновления в текущем чате
+type StateModule struct {
+	states States
+	chatId int64
+	userId int64
+}
+
+func NewState(states States, chatId, userId int64) *StateModule {
+	return &StateModule{states: states, chatId: chatId, userId: userId}
+}
@@ -0,0 +1,77 @@
+package lua_modules
+
+import (
+	h "github.com/end1essrage/indigo-core/lua/helpers"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// users_get(id) -> (user: table?, err?)
+func (m *UsersModule) applyGet(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		id := L.CheckInt64(1)
+
+		user, err := m.service.GetUser(id)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		//пользователь не найден
+		if user == nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LNil)
+			return 2
+		}
+
+		L.Push(h.ConvertToLuaTable(L, user))
+		L.Push(lua.LNil)
+		return 2
+	}))
+}
+
+// has_role(user_id, role) -> bool
+func (m *UsersModule) applyHasRole(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		ok, err := m.service.HasRole(L.CheckInt64(1), L.CheckString(2))
+		if err != nil {
+			logrus.Errorf("ошибка проверки роли: %v", err)
+		}
+
+		L.Push(lua.LBool(ok))
+		return 1
+	}))
+}
+
+// set_role(user_id, role) -> err?
+func (m *UsersModule) applySetRole(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if err := m.service.SetRole(L.CheckInt64(1), L.CheckString(2)); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+
+		L.Push(lua.LNil)
+		return 1
+	}))
+}
+
+// remove_role(user_id, role) -> err?
+func (m *UsersModule) applyRemoveRole(L *lua.LState, cmd string) {
+	L.SetGlobal(cmd, L.NewFunction(func(L *lua.LState) int {
+		if err := m.service.RemoveRole(L.CheckInt64(1), L.CheckString(2)); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+
+		L.Push(lua.LNil)
+		return 1
+	}))
+}
+
+type UsersModule struct{ service Service }
+
+func NewUsers(service Service) *UsersModule {
+	return &UsersModule{service: service}
+}
@@ -0,0 +1,116 @@
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// statePool ограниченный пул стейтов с уже загруженными модулями
+// стейты сверх размера пула создаются по требованию и закрываются после использования
+type statePool struct {
+	states chan *pooledState
+	build  func() *lua.LState
+}
+
+// pooledState стейт и содержимое его таблиц сразу после инициализации модулей
+type pooledState struct {
+	L      *lua.LState
+	tables map[*lua.LTable]tableSnapshot
+}
+
+// tableSnapshot поля и метатаблица таблицы
+type tableSnapshot struct {
+	fields map[lua.LValue]lua.LValue
+	meta   lua.LValue
+}
+
+func newStatePool(size int, build func() *lua.LState) *statePool {
+	p := &statePool{states: make(chan *pooledState, size), build: build}
+	for i := 0; i < size; i++ {
+		p.states <- p.newState()
+	}
+	return p
+}
+
+func (p *statePool) newState() *pooledState {
+	L := p.build()
+	return &pooledState{L: L, tables: snapshotTables(L)}
+}
+
+// snapshotTables запоминает глобальные переменные и все достижимые из них таблицы (string, table, package.loaded ...)
+// стейт переходит между пользователями, поэтому правки библиотек скриптом не должны пережить выполнение
+func snapshotTables(L *lua.LState) map[*lua.LTable]tableSnapshot {
+	tables := make(map[*lua.LTable]tableSnapshot)
+
+	var walk func(t *lua.LTable)
+	walk = func(t *lua.LTable) {
+		if _, seen := tables[t]; seen {
+			return
+		}
+		snap := tableSnapshot{fields: make(map[lua.LValue]lua.LValue), meta: t.Metatable}
+		tables[t] = snap
+
+		t.ForEach(func(k, v lua.LValue) {
+			snap.fields[k] = v
+			if tbl, ok := v.(*lua.LTable); ok {
+				walk(tbl)
+			}
+		})
+		if mt, ok := t.Metatable.(*lua.LTable); ok {
+			walk(mt)
+		}
+	}
+
+	walk(L.G.Global)
+	// методы строк ("abc"):upper() идут через метатаблицу строк
+	if mt, ok := L.GetMetatable(lua.LString("")).(*lua.LTable); ok {
+		walk(mt)
+	}
+	return tables
+}
+
+func (p *statePool) get() *pooledState {
+	select {
+	case s := <-p.states:
+		return s
+	default:
+		return p.newState()
+	}
+}
+
+// put возвращает стейт в пул, после ошибки выполнения стейт не переиспользуется
+func (p *statePool) put(s *pooledState, failed bool) {
+	if failed {
+		s.L.Close()
+		return
+	}
+
+	s.reset()
+	select {
+	case p.states <- s:
+	default:
+		s.L.Close()
+	}
+}
+
+// reset убирает переменные скрипта и возвращает глобальные переменные и библиотеки к исходному виду
+func (s *pooledState) reset() {
+	L := s.L
+	L.SetTop(0)
+	L.RemoveContext()
+
+	for t, snap := range s.tables {
+		var extra []lua.LValue
+		t.ForEach(func(k, _ lua.LValue) {
+			if _, ok := snap.fields[k]; !ok {
+				extra = append(extra, k)
+			}
+		})
+		for _, k := range extra {
+			t.RawSet(k, lua.LNil)
+		}
+		for k, v := range snap.fields {
+			t.RawSet(k, v)
+		}
+		t.Metatable = snap.meta
+	}
+}
@@ -0,0 +1,97 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPooledStateReset(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		// портит глобальные переменные и функции модулей
+		"dirty.lua": `leaked = ctx.text; json_encode = nil; return "ok"`,
+		"clean.lua": `return tostring(leaked) .. ":" .. type(json_encode) .. ":" .. ctx.text`,
+		"fail.lua":  `error("boom")`,
+	}
+	for name, code := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatalf("write script: %v", err)
+		}
+	}
+
+	// один стейт в пуле - второй скрипт выполняется в том же стейте
+	defer func(size int) { defaultPoolSize = size }(defaultPoolSize)
+	defaultPoolSize = 1
+	le := NewLuaEngine(nil, nil, nil, nil, dir, nil, nil, nil, nil)
+
+	if _, err := le.ExecuteScriptWithResult("dirty", LuaContext{MessageText: "first"}); err != nil {
+		t.Fatalf("dirty failed: %v", err)
+	}
+	got, err := le.ExecuteScriptWithResult("clean", LuaContext{MessageText: "second"})
+	if err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+	if got != "nil:function:second" {
+		t.Errorf("state not reset between runs: %v", got)
+	}
+
+	if _, err := le.ExecuteScriptWithResult("fail", LuaContext{}); err == nil {
+		t.Error("expected script error")
+	}
+	if _, err := le.ExecuteScriptWithResult("clean", LuaContext{MessageText: "after error"}); err != nil {
+		t.Errorf("engine broken after script error: %v", err)
+	}
+}
+
+func TestBrokenScript(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.lua"), []byte(`if then`), 0644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	le := NewLuaEngine(nil, nil, nil, nil, dir, nil, nil, nil, nil)
+	if _, err := le.ExecuteScriptWithResult("broken", LuaContext{}); err == nil {
+		t.Error("expected compile error on execution")
+	}
+	if _, err := le.ExecuteScriptWithResult("missing", LuaContext{}); err == nil {
+		t.Error("expected error for missing script")
+	}
+}
+
+func TestPooledStateResetLibraries(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		// правит библиотеки, метатаблицу строк и кэш пакетов
+		"dirty.lua": `string.x = "leak"
+string.upper = function() return "hacked" end
+table.insert = nil
+math.pi = 3
+package.loaded.evil = {}
+getmetatable("").__index = {len = function() return -1 end}
+return "ok"`,
+		"clean.lua": `return tostring(string.x) .. ":" .. ("abc"):upper() .. ":" .. type(table.insert) .. ":" ..
+	tostring(math.pi > 3.14) .. ":" .. tostring(package.loaded.evil) .. ":" .. ("abc"):len()`,
+	}
+	for name, code := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatalf("write script: %v", err)
+		}
+	}
+
+	// один стейт в пуле - второй скрипт выполняется в том же стейте
+	defer func(size int) { defaultPoolSize = size }(defaultPoolSize)
+	defaultPoolSize = 1
+	le := NewLuaEngine(nil, nil, nil, nil, dir, nil, nil, nil, nil)
+
+	if _, err := le.ExecuteScriptWithResult("dirty", LuaContext{}); err != nil {
+		t.Fatalf("dirty failed: %v", err)
+	}
+	got, err := le.ExecuteScriptWithResult("clean", LuaContext{})
+	if err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+	if got != "nil:ABC:function:true:nil:3" {
+		t.Errorf("libraries not reset between runs: %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package lua
+
+import (
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// applyRequire подменяет require: модули ищутся среди загруженных скриптов, а не на диске
+// кэш модулей живет одно выполнение, чтобы таблицы модулей не протекали между обновлениями в пуле
+func (le *LuaEngine) applyRequire(L *lua.LState) {
+	// скрипт и его модули берутся из одной версии, даже если во время выполнения была перезагрузка
+	le.mu.RLock()
+	scripts, broken := le.scripts, le.broken
+	le.mu.RUnlock()
+
+	loaded := make(map[string]lua.LValue)
+	var loading []string
+
+	L.SetGlobal("require", L.NewFunction(func(L *lua.LState) int {
+		name := moduleName(L.CheckString(1))
+
+		if v, ok := loaded[name]; ok {
+			L.Push(v)
+			return 1
+		}
+
+		if slices.Contains(loading, name) {
+			L.RaiseError("циклический require: %s -> %s", strings.Join(loading, " -> "), name)
+		}
+		if err := broken[name]; err != nil {
+			L.RaiseError("модуль %s не скомпилирован: %v", name, err)
+		}
+		proto, ok := scripts[name]
+		if !ok {
+			L.RaiseError("модуль %s не найден", name)
+		}
+
+		loading = append(loading, name)
+		L.Push(L.NewFunctionFromProto(proto))
+		err := L.PCall(0, 1, nil)
+		loading = loading[:len(loading)-1]
+		if err != nil {
+			if apiErr, ok := err.(*lua.ApiError); ok {
+				L.Error(apiErr.Object, 0)
+			}
+			L.RaiseError("%v", err)
+		}
+
+		// как в луа: модуль без return загружен, но ничего не экспортирует
+		v := L.Get(-1)
+		L.Pop(1)
+		if v == lua.LNil {
+			v = lua.LTrue
+		}
+
+		loaded[name] = v
+		L.Push(v)
+		return 1
+	}))
+}
+
+// moduleName ключ скрипта: "lib/utils", "lib.utils" и "lib/utils.lua" - один модуль
+func moduleName(name string) string {
+	name = strings.TrimSuffix(name, ".lua")
+	return strings.ReplaceAll(name, ".", "/")
+}
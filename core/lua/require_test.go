@@ -0,0 +1,73 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		// счетчик показывает сколько раз выполнился модуль
+		"lib/utils.lua": `loads = (loads or 0) + 1
+local M = {}
+function M.greet(name) return "Привет, " .. name end
+return M`,
+		"lib/noreturn.lua": `x = 1`,
+		"lib/a.lua":        `return require("lib/b")`,
+		"lib/b.lua":        `return require("lib/a")`,
+		"lib/broken.lua":   `if then`,
+		"main.lua": `local u = require("lib/utils")
+local same = require("lib.utils")
+return u.greet(ctx.text) .. ":" .. loads .. ":" .. tostring(u == same) .. ":" .. tostring(require("lib/noreturn"))`,
+		"cycle.lua":   `return require("lib/a")`,
+		"missing.lua": `return require("lib/nope")`,
+		"broken.lua":  `return require("lib/broken")`,
+		"protected.lua": `local ok = pcall(require, "lib/a")
+return tostring(ok) .. ":" .. require("lib/utils").greet("мир")`,
+	}
+	for name, code := range scripts {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatalf("write script: %v", err)
+		}
+	}
+
+	le := NewLuaEngine(nil, nil, nil, nil, dir, nil, nil, nil, nil)
+
+	// модуль выполняется один раз за запуск, в следующем запуске кэш свежий
+	for i := 0; i < 2; i++ {
+		got, err := le.ExecuteScriptWithResult("main", LuaContext{MessageText: "Вася"})
+		if err != nil {
+			t.Fatalf("main failed: %v", err)
+		}
+		if got != "Привет, Вася:1:true:true" {
+			t.Errorf("run %d: got %v", i, got)
+		}
+	}
+
+	errCases := map[string]string{
+		"cycle":   "циклический require: lib/a -> lib/b -> lib/a",
+		"missing": "модуль lib/nope не найден",
+		"broken":  "модуль lib/broken не скомпилирован",
+	}
+	for script, want := range errCases {
+		t.Run(script, func(t *testing.T) {
+			_, err := le.ExecuteScriptWithResult(script, LuaContext{})
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("err = %v, want %q", err, want)
+			}
+		})
+	}
+
+	// ошибка под pcall не оставляет модуль "загружающимся"
+	got, err := le.ExecuteScriptWithResult("protected", LuaContext{})
+	if err != nil || got != "false:Привет, мир" {
+		t.Errorf("protected = %v, %v", got, err)
+	}
+}
@@ -10,17 +10,64 @@ import (
 type LuaContext struct {
 	RequestData map[string]interface{}
 	FormData    map[string]interface{}
+	// данные которыми перехватчики обогатили контекст
+	Data        map[string]interface{}
 	Headers     http.Header
 	MessageText string
 	CbData      LuaCbData
 	ChatId      int64
 	FromId      int64
 	FromName    string
+	// сообщение обновления (для кнопок - сообщение с клавиатурой)
+	MessageId int
+	// id нажатия кнопки для answer_callback
+	CallbackId string
+	// контакт и геопозиция из reply кнопок с запросом
+	Contact  *LuaContact
+	Location *LuaLocation
+	// вложение сообщения
+	Media *LuaMedia
+	// состояние диалога, если сообщение пришло скрипту состояния
+	State *LuaDialogState
+}
+
+type LuaDialogState struct {
+	Name string
+	Data map[string]interface{}
+}
+
+type LuaMedia struct {
+	Kind         string
+	FileId       string
+	FileUniqueId string
+	FileName     string
+	MimeType     string
+	Size         int
+	Width        int
+	Height       int
+	Duration     int
+	Caption      string
+	// общий id вложений одного альбома
+	GroupId string
+}
+
+type LuaContact struct {
+	Phone     string
+	FirstName string
+	LastName  string
+	UserId    int64
+}
+
+type LuaLocation struct {
+	Lat float64
+	Lon float64
 }
 
 type LuaCbData struct {
-	Script string
-	Data   string
+	Script  string
+	Data    string
+	Roles   []string
+	OnPress string
 }
 
 type Module interface {
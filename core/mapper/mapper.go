@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	b "github.com/end1essrage/indigo-core/bot"
+	cfg "github.com/end1essrage/indigo-core/config"
 	l "github.com/end1essrage/indigo-core/lua"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
@@ -15,27 +16,158 @@ func FromTgUpdateToLuaContext(update *tgbotapi.Update) l.LuaContext {
 	c.FromId = update.Message.From.ID
 	c.FromName = update.Message.From.UserName
 	c.MessageText = update.Message.Text
+	c.MessageId = update.Message.MessageID
 	return c
 }
 
+// FromUpdateToLuaContext безопасно собирает контекст для любого типа обновления
+func FromUpdateToLuaContext(update *tgbotapi.Update) l.LuaContext {
+	if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+		return FromCallbackQueryToLuaContext(update.CallbackQuery)
+	}
+
+	c := l.LuaContext{}
+	if msg := UpdateMessage(update); msg != nil {
+		if msg.Chat != nil {
+			c.ChatId = msg.Chat.ID
+		}
+		c.MessageText = msg.Text
+		c.MessageId = msg.MessageID
+
+		if msg.Contact != nil {
+			c.Contact = &l.LuaContact{
+				Phone:     msg.Contact.PhoneNumber,
+				FirstName: msg.Contact.FirstName,
+				LastName:  msg.Contact.LastName,
+				UserId:    msg.Contact.UserID,
+			}
+		}
+		if msg.Location != nil {
+			c.Location = &l.LuaLocation{Lat: msg.Location.Latitude, Lon: msg.Location.Longitude}
+		}
+		c.Media = MessageMedia(msg)
+	}
+
+	if from := update.SentFrom(); from != nil {
+		c.FromId = from.ID
+		c.FromName = from.UserName
+	}
+
+	return c
+}
+
+// MessageMedia описание вложения сообщения, nil если его нет
+func MessageMedia(msg *tgbotapi.Message) *l.LuaMedia {
+	media := &l.LuaMedia{Caption: msg.Caption, GroupId: msg.MediaGroupID}
+
+	switch {
+	case len(msg.Photo) > 0:
+		// тг присылает несколько размеров, берем самый большой
+		p := msg.Photo[len(msg.Photo)-1]
+		media.Kind = string(cfg.MediaKind_Photo)
+		media.FileId, media.FileUniqueId, media.Size = p.FileID, p.FileUniqueID, p.FileSize
+		media.Width, media.Height = p.Width, p.Height
+		media.MimeType = "image/jpeg"
+	case msg.Document != nil:
+		d := msg.Document
+		media.Kind = string(cfg.MediaKind_Document)
+		media.FileId, media.FileUniqueId, media.Size = d.FileID, d.FileUniqueID, d.FileSize
+		media.FileName, media.MimeType = d.FileName, d.MimeType
+	case msg.Audio != nil:
+		a := msg.Audio
+		media.Kind = string(cfg.MediaKind_Audio)
+		media.FileId, media.FileUniqueId, media.Size = a.FileID, a.FileUniqueID, a.FileSize
+		media.FileName, media.MimeType, media.Duration = a.FileName, a.MimeType, a.Duration
+	case msg.Video != nil:
+		v := msg.Video
+		media.Kind = string(cfg.MediaKind_Video)
+		media.FileId, media.FileUniqueId, media.Size = v.FileID, v.FileUniqueID, v.FileSize
+		media.FileName, media.MimeType, media.Duration = v.FileName, v.MimeType, v.Duration
+		media.Width, media.Height = v.Width, v.Height
+	case msg.Voice != nil:
+		v := msg.Voice
+		media.Kind = string(cfg.MediaKind_Voice)
+		media.FileId, media.FileUniqueId, media.Size = v.FileID, v.FileUniqueID, v.FileSize
+		media.MimeType, media.Duration = v.MimeType, v.Duration
+	case msg.VideoNote != nil:
+		v := msg.VideoNote
+		media.Kind = string(cfg.MediaKind_VideoNote)
+		media.FileId, media.FileUniqueId, media.Size = v.FileID, v.FileUniqueID, v.FileSize
+		media.Width, media.Height, media.Duration = v.Length, v.Length, v.Duration
+	case msg.Animation != nil:
+		a := msg.Animation
+		media.Kind = string(cfg.MediaKind_Animation)
+		media.FileId, media.FileUniqueId, media.Size = a.FileID, a.FileUniqueID, a.FileSize
+		media.FileName, media.MimeType, media.Duration = a.FileName, a.MimeType, a.Duration
+		media.Width, media.Height = a.Width, a.Height
+	case msg.Sticker != nil:
+		st := msg.Sticker
+		media.Kind = string(cfg.MediaKind_Sticker)
+		media.FileId, media.FileUniqueId, media.Size = st.FileID, st.FileUniqueID, st.FileSize
+		media.Width, media.Height = st.Width, st.Height
+	default:
+		return nil
+	}
+
+	return media
+}
+
+// UpdateMessage возвращает сообщение из обновления независимо от его типа
+func UpdateMessage(update *tgbotapi.Update) *tgbotapi.Message {
+	switch {
+	case update.Message != nil:
+		return update.Message
+	case update.EditedMessage != nil:
+		return update.EditedMessage
+	case update.ChannelPost != nil:
+		return update.ChannelPost
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Message
+	}
+	return nil
+}
+
 func FromCallbackQueryToLuaContext(cb *tgbotapi.CallbackQuery) l.LuaContext {
 	c := l.LuaContext{}
 	c.ChatId = cb.Message.Chat.ID
 	c.FromId = cb.From.ID
 	c.FromName = cb.From.UserName
 	c.CbData = FromCallbackDataToLuaCbData(cb.Data)
+	c.MessageId = cb.Message.MessageID
+	c.CallbackId = cb.ID
 	return c
 }
 
 func FromCallbackDataToLuaCbData(data string) l.LuaCbData {
-	res := l.LuaCbData{}
+	res, err := DecodeCbData(data)
+	if err != nil {
+		logrus.Errorf("ошибка десериализции данных кнопки: %v", err)
+	}
+	return res
+}
+
+// DecodeCbData разбирает развернутые данные кнопки (см. TgBot.ResolveCallback)
+func DecodeCbData(data string) (l.LuaCbData, error) {
 	d := b.CbData{}
 	if err := json.Unmarshal([]byte(data), &d); err != nil {
-		logrus.Error("ошибка десериализции")
+		return l.LuaCbData{}, err
 	}
 
-	res.Script = *d.Script
-	res.Data = *d.Data
+	return FromCbData(d), nil
+}
+
+func FromCbData(d b.CbData) l.LuaCbData {
+	res := l.LuaCbData{}
+	if d.Script != nil {
+		res.Script = *d.Script
+	}
+	if d.Data != nil {
+		res.Data = *d.Data
+	}
+	res.Roles = d.Roles
+	res.OnPress = d.OnPress
 
 	return res
 }
@@ -0,0 +1,211 @@
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	keyRegex    = regexp.MustCompile(`^[a-f0-9]{32}$`)
+	uniqueRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// LocalStore файлы в папке на диске:
+// files/<key> - содержимое, meta/<key>.json - метаданные, unique/<file_unique_id> - ключ для дедупликации
+type LocalStore struct {
+	path    string
+	baseUrl string
+	mu      sync.Mutex
+}
+
+func NewLocalStore(path, baseUrl string) (*LocalStore, error) {
+	for _, dir := range []string{"files", "meta", "unique"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LocalStore{path: path, baseUrl: strings.TrimRight(baseUrl, "/")}, nil
+}
+
+func (s *LocalStore) Save(r io.Reader, meta Meta) (Meta, error) {
+	if meta.FileUniqueId != "" && !uniqueRegex.MatchString(meta.FileUniqueId) {
+		return Meta{}, fmt.Errorf("некорректный file_unique_id %s", meta.FileUniqueId)
+	}
+
+	// без блокировки два одинаковых файла могли бы сохраниться под разными ключами
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.findUnique(meta.FileUniqueId); ok {
+		return existing, nil
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		return Meta{}, err
+	}
+
+	f, err := os.Create(s.filePath(key))
+	if err != nil {
+		return Meta{}, err
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.filePath(key))
+		return Meta{}, err
+	}
+
+	meta.Key = key
+	meta.Size = size
+	meta.CreatedAt = time.Now()
+
+	body, err := json.Marshal(meta)
+	if err != nil {
+		os.Remove(s.filePath(key))
+		return Meta{}, err
+	}
+	if err := os.WriteFile(s.metaPath(key), body, 0644); err != nil {
+		os.Remove(s.filePath(key))
+		return Meta{}, err
+	}
+
+	if meta.FileUniqueId != "" {
+		if err := os.WriteFile(s.uniquePath(meta.FileUniqueId), []byte(key), 0644); err != nil {
+			return Meta{}, err
+		}
+	}
+
+	return meta, nil
+}
+
+func (s *LocalStore) Get(key string) (Meta, error) {
+	if !keyRegex.MatchString(key) {
+		return Meta{}, ErrNotFound
+	}
+
+	body, err := os.ReadFile(s.metaPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return Meta{}, ErrNotFound
+	}
+	if err != nil {
+		return Meta{}, err
+	}
+
+	var meta Meta
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return Meta{}, err
+	}
+
+	return meta, nil
+}
+
+func (s *LocalStore) FindUnique(fileUniqueId string) (Meta, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findUnique(fileUniqueId)
+}
+
+func (s *LocalStore) findUnique(fileUniqueId string) (Meta, bool) {
+	if !uniqueRegex.MatchString(fileUniqueId) {
+		return Meta{}, false
+	}
+
+	key, err := os.ReadFile(s.uniquePath(fileUniqueId))
+	if err != nil {
+		return Meta{}, false
+	}
+
+	// файл могли удалить вручную, тогда индекс устарел
+	meta, err := s.Get(string(key))
+	if err != nil {
+		return Meta{}, false
+	}
+
+	return meta, true
+}
+
+func (s *LocalStore) Open(key string) (string, io.ReadCloser, error) {
+	meta, err := s.Get(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	f, err := os.Open(s.filePath(key))
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := meta.FileName
+	if name == "" {
+		name = key
+	}
+
+	return name, f, nil
+}
+
+// URL ссылка вида <base_url>/<key>, раздавать папку files должен веб сервер
+func (s *LocalStore) URL(key string) (string, error) {
+	if s.baseUrl == "" {
+		return "", fmt.Errorf("не задан base_url хранилища медиа")
+	}
+
+	if _, err := s.Get(key); err != nil {
+		return "", err
+	}
+
+	return s.baseUrl + "/" + key, nil
+}
+
+func (s *LocalStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if meta.FileUniqueId != "" {
+		os.Remove(s.uniquePath(meta.FileUniqueId))
+	}
+	if err := os.Remove(s.filePath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return os.Remove(s.metaPath(key))
+}
+
+func (s *LocalStore) filePath(key string) string {
+	return filepath.Join(s.path, "files", key)
+}
+
+func (s *LocalStore) metaPath(key string) string {
+	return filepath.Join(s.path, "meta", key+".json")
+}
+
+func (s *LocalStore) uniquePath(fileUniqueId string) string {
+	return filepath.Join(s.path, "unique", fileUniqueId)
+}
+
+func generateKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
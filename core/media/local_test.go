@@ -0,0 +1,63 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "https://cdn.example.com/media/")
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+
+	meta, err := store.Save(strings.NewReader("photo"), Meta{FileUniqueId: "AQADx", FileName: "a.jpg", Mime: "image/jpeg", SenderId: 1, ChatId: 2})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if meta.Key == "" || meta.Size != 5 || meta.SenderId != 1 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+
+	// тот же файл повторно не сохраняется
+	again, err := store.Save(strings.NewReader("photo"), Meta{FileUniqueId: "AQADx"})
+	if err != nil || again.Key != meta.Key {
+		t.Fatalf("duplicate should return existing key, got %+v %v", again, err)
+	}
+
+	if found, ok := store.FindUnique("AQADx"); !ok || found.Key != meta.Key {
+		t.Fatalf("FindUnique failed: %+v", found)
+	}
+
+	name, r, err := store.Open(meta.Key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	body, _ := io.ReadAll(r)
+	r.Close()
+	if name != "a.jpg" || string(body) != "photo" {
+		t.Errorf("unexpected file %s %q", name, body)
+	}
+
+	url, err := store.URL(meta.Key)
+	if err != nil || url != "https://cdn.example.com/media/"+meta.Key {
+		t.Errorf("unexpected url %s %v", url, err)
+	}
+
+	if err := store.Delete(meta.Key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(meta.Key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if _, ok := store.FindUnique("AQADx"); ok {
+		t.Error("unique index should be removed with file")
+	}
+
+	// ключи вне формата не превращаются в пути
+	if _, err := store.Get("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for bad key, got %v", err)
+	}
+}
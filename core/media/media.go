@@ -1,7 +1,85 @@
 package media
 
-//Сохранение разных типов медиа в разные места
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
 
-// на примере локального хранилища с папкой - реализовать сохранение фото + генерации ключа для получения и возвращение его
+	c "github.com/end1essrage/indigo-core/config"
+)
 
-// сохранение ссылки на медиа присланную тг ботом
+//Сохранение присланных боту файлов, по ключу файл можно достать или отправить обратно (send_photo(chat, {key = ...}))
+
+const (
+	StoreType_Local = "local"
+	// папка локального хранилища если путь не задан
+	defaultLocalPath = "media"
+)
+
+var ErrNotFound = errors.New("файл не найден")
+
+// Meta метаданные сохраненного файла
+type Meta struct {
+	Key string `json:"key"`
+	// id файла в тг, одинаковый для всех ботов, по нему файлы не дублируются
+	FileUniqueId string    `json:"file_unique_id"`
+	FileName     string    `json:"file_name,omitempty"`
+	Mime         string    `json:"mime,omitempty"`
+	Size         int64     `json:"size"`
+	SenderId     int64     `json:"sender_id,omitempty"`
+	ChatId       int64     `json:"chat_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Store хранилище медиа
+type Store interface {
+	// Save сохраняет файл, если файл с тем же FileUniqueId уже есть - возвращает его
+	Save(r io.Reader, meta Meta) (Meta, error)
+	Get(key string) (Meta, error)
+	// FindUnique ищет уже сохраненный файл по id тг
+	FindUnique(fileUniqueId string) (Meta, bool)
+	// Open имя файла и содержимое, подходит для отправки через бота
+	Open(key string) (string, io.ReadCloser, error)
+	// URL публичная ссылка на файл
+	URL(key string) (string, error)
+	Delete(key string) error
+}
+
+// NewStore хранилище по конфигу, nil если медиа не настроены
+func NewStore(cfg c.MediaConfig) (Store, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case StoreType_Local:
+		path, baseUrl := defaultLocalPath, ""
+		if cfg.Local != nil {
+			if cfg.Local.Path != "" {
+				path = cfg.Local.Path
+			}
+			baseUrl = cfg.Local.BaseUrl
+		}
+		return NewLocalStore(path, baseUrl)
+	}
+	return nil, fmt.Errorf("неизвестный тип хранилища медиа %s", cfg.Type)
+}
+
+// Downloader скачивает присланный боту файл по file_id
+type Downloader interface {
+	DownloadFile(fileId string) (io.ReadCloser, error)
+}
+
+// Fetch скачивает файл из тг и сохраняет в хранилище, уже сохраненный файл повторно не качается
+func Fetch(store Store, d Downloader, fileId string, meta Meta) (Meta, error) {
+	if existing, ok := store.FindUnique(meta.FileUniqueId); ok {
+		return existing, nil
+	}
+
+	body, err := d.DownloadFile(fileId)
+	if err != nil {
+		return Meta{}, err
+	}
+	defer body.Close()
+
+	return store.Save(body, meta)
+}
@@ -0,0 +1,31 @@
+package receiver
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const pollingTimeout = 60
+
+type Polling struct {
+	bot *tgbotapi.BotAPI
+}
+
+func NewPolling(bot *tgbotapi.BotAPI) *Polling {
+	return &Polling{bot: bot}
+}
+
+func (p *Polling) Start() (tgbotapi.UpdatesChannel, error) {
+	//на случай если до этого бот работал через вебхук
+	if _, err := p.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, err
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = pollingTimeout
+
+	return p.bot.GetUpdatesChan(u), nil
+}
+
+func (p *Polling) Stop() {
+	p.bot.StopReceivingUpdates()
+}
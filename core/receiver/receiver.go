@@ -0,0 +1,11 @@
+package receiver
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Receiver источник обновлений от тг (поллинг или вебхук)
+type Receiver interface {
+	Start() (tgbotapi.UpdatesChannel, error)
+	Stop()
+}
@@ -0,0 +1,171 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	secretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	defaultPath    = "/webhook"
+	defaultBuffer  = 100
+	requestTimeout = 10 * time.Second
+)
+
+// Webhook принимает обновления от тг по http и складывает их в канал,
+// который обрабатывается тем же пайплайном что и при поллинге
+type Webhook struct {
+	bot      *tgbotapi.BotAPI
+	config   *config.WebhookConfig
+	secret   string
+	server   *http.Server
+	listener net.Listener
+	updates  chan tgbotapi.Update
+	stopping bool
+	mu       sync.RWMutex
+	stopOnce sync.Once
+}
+
+func NewWebhook(bot *tgbotapi.BotAPI, cfg *config.WebhookConfig, secret string) *Webhook {
+	return &Webhook{
+		bot:     bot,
+		config:  cfg,
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, defaultBuffer),
+	}
+}
+
+// Start поднимает листенер и регистрирует вебхук в тг
+func (w *Webhook) Start() (tgbotapi.UpdatesChannel, error) {
+	ln, err := net.Listen("tcp", w.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	w.listener = ln
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(w.path(), w.handle)
+
+	w.server = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  requestTimeout,
+		WriteTimeout: requestTimeout,
+	}
+
+	go func() {
+		logrus.Infof("Starting webhook listener on %s%s", ln.Addr().String(), w.path())
+		if err := w.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("Webhook server error: %v", err)
+		}
+	}()
+
+	if err := w.register(); err != nil {
+		w.server.Close()
+		return nil, err
+	}
+
+	return w.updates, nil
+}
+
+// Stop перестает принимать обновления, снимает вебхук и закрывает канал
+func (w *Webhook) Stop() {
+	w.stopOnce.Do(w.stop)
+}
+
+func (w *Webhook) stop() {
+	if _, err := w.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		logrus.Errorf("ошибка снятия вебхука: %v", err)
+	}
+
+	if w.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := w.server.Shutdown(ctx); err != nil {
+			logrus.Errorf("Webhook server shutdown error: %v", err)
+		}
+	}
+
+	// дожидаемся отправляющих обработчиков и закрываем канал
+	w.mu.Lock()
+	w.stopping = true
+	close(w.updates)
+	w.mu.Unlock()
+}
+
+// Addr адрес на котором реально слушаем (полезно при порте 0)
+func (w *Webhook) Addr() string {
+	if w.listener == nil {
+		return ""
+	}
+	return w.listener.Addr().String()
+}
+
+func (w *Webhook) register() error {
+	//secret_token не поддерживается конфигом библиотеки, поэтому собираем параметры сами
+	params := make(tgbotapi.Params)
+	params["url"] = strings.TrimRight(w.config.Url, "/") + w.path()
+	params.AddNonEmpty("secret_token", w.secret)
+	params.AddNonZero("max_connections", w.config.MaxConnections)
+	params.AddBool("drop_pending_updates", w.config.DropPending)
+
+	if _, err := w.bot.MakeRequest("setWebhook", params); err != nil {
+		return err
+	}
+
+	logrus.Infof("webhook registered on %s", params["url"])
+	return nil
+}
+
+func (w *Webhook) handle(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.secret != "" && r.Header.Get(secretHeader) != w.secret {
+		logrus.Warnf("webhook request with wrong secret from %s", r.RemoteAddr)
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	// после остановки канал закрыт, тг повторит доставку позже
+	if w.stopping {
+		http.Error(rw, "stopping", http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case w.updates <- update:
+		rw.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		http.Error(rw, "timeout", http.StatusServiceUnavailable)
+	}
+}
+
+func (w *Webhook) path() string {
+	if w.config.Path == "" {
+		return defaultPath
+	}
+	if !strings.HasPrefix(w.config.Path, "/") {
+		return "/" + w.config.Path
+	}
+	return w.config.Path
+}
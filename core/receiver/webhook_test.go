@@ -0,0 +1,141 @@
+package receiver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/end1essrage/indigo-core/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram локальная замена Telegram Bot API, запоминает вызванные методы
+type fakeTelegram struct {
+	mu     sync.Mutex
+	calls  []string
+	params map[string]map[string]string
+}
+
+func (f *fakeTelegram) handler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	p := make(map[string]string)
+	for k := range r.PostForm {
+		p[k] = r.PostForm.Get(k)
+	}
+	f.params[method] = p
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getMe":
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"test","username":"test_bot"}}`))
+	default:
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (f *fakeTelegram) called(method string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if c == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeTelegram) param(method, key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.params[method][key]
+}
+
+func setupWebhook(t *testing.T, secret string) (*Webhook, *fakeTelegram, func()) {
+	fake := &fakeTelegram{params: make(map[string]map[string]string)}
+	tg := httptest.NewServer(http.HandlerFunc(fake.handler))
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", tg.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+
+	cfg := &config.WebhookConfig{
+		Address: "127.0.0.1:0",
+		Path:    "/tg",
+		Url:     "https://example.com/",
+	}
+
+	return NewWebhook(bot, cfg, secret), fake, tg.Close
+}
+
+func TestWebhookLifecycle(t *testing.T) {
+	wh, fake, cleanup := setupWebhook(t, "s3cr3t")
+	defer cleanup()
+
+	updates, err := wh.Start()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if !fake.called("setWebhook") {
+		t.Fatal("setWebhook was not called")
+	}
+	if got := fake.param("setWebhook", "url"); got != "https://example.com/tg" {
+		t.Errorf("unexpected webhook url %q", got)
+	}
+	if got := fake.param("setWebhook", "secret_token"); got != "s3cr3t" {
+		t.Errorf("unexpected secret_token %q", got)
+	}
+
+	url := "http://" + wh.Addr() + "/tg"
+	body := []byte(`{"update_id":42,"message":{"message_id":1,"text":"hi","chat":{"id":5,"type":"private"}}}`)
+
+	// без секрета запрос отклоняется
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set(secretHeader, "s3cr3t")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	select {
+	case upd := <-updates:
+		if upd.UpdateID != 42 || upd.Message == nil || upd.Message.Text != "hi" {
+			t.Errorf("unexpected update %+v", upd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("update was not delivered")
+	}
+
+	wh.Stop()
+
+	if !fake.called("deleteWebhook") {
+		t.Error("deleteWebhook was not called")
+	}
+
+	if _, ok := <-updates; ok {
+		t.Error("updates channel should be closed after Stop")
+	}
+}
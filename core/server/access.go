@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const defaultAccessDenied = "отказано в доступе"
+
+// checkAccess проверяет роли пользователя, при отказе отвечает в чат
+func (s *Server) checkAccess(userId, chatId int64, roles []string) bool {
+	ok, err := s.service.HasAnyRole(userId, roles)
+	if err != nil {
+		logrus.Errorf("ошибка проверки ролей пользователя %d: %v", userId, err)
+	}
+	if ok {
+		return true
+	}
+
+	logrus.WithFields(logrus.Fields{"user_id": userId, "roles": roles}).Info("отказано в доступе")
+	s.bot.SendMessage(chatId, s.accessDeniedText())
+	return false
+}
+
+func (s *Server) accessDeniedText() string {
+	if s.config.Bot.AccessDenied != nil && *s.config.Bot.AccessDenied != "" {
+		return *s.config.Bot.AccessDenied
+	}
+	return defaultAccessDenied
+}
@@ -2,75 +2,490 @@ package server
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/end1essrage/indigo-core/admin"
 	b "github.com/end1essrage/indigo-core/bot"
+	c "github.com/end1essrage/indigo-core/config"
+	l "github.com/end1essrage/indigo-core/lua"
+	m "github.com/end1essrage/indigo-core/mapper"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
 )
 
 // обработка запроса на авторизацию как админа
 func (s *Server) handleAdm(upd *tgbotapi.Update) {
-	//проверили что чат личный
-	if !upd.Message.Chat.IsPrivate() {
-		s.bot.SendMessage(upd.Message.Chat.ID, "Нельзя вызывать админ меню не в личном чате")
+	msg := m.UpdateMessage(upd)
+
+	//проверили что чат личный (в каналах и группах меню не показываем)
+	if !msg.Chat.IsPrivate() || msg.From == nil {
+		if !msg.Chat.IsChannel() {
+			s.bot.SendMessage(msg.Chat.ID, "Нельзя вызывать админ меню не в личном чате")
+		}
+		return
+	}
+
+	userId := msg.From.ID
+	audit := logrus.WithFields(logrus.Fields{"user_id": userId, "username": msg.From.UserName})
+
+	// /adm <токен> - получение прав по одноразовому токену
+	if token := strings.TrimSpace(msg.CommandArguments()); token != "" && !s.isAdmin(userId) {
+		ok, err := s.service.ClaimAdmin(userId, token)
+		if err != nil {
+			audit.Errorf("ошибка выдачи прав админа: %v", err)
+			s.bot.SendMessage(userId, "ошибка выдачи прав")
+			return
+		}
+		if !ok {
+			audit.Warn("неверный токен админа")
+			s.bot.SendMessage(userId, "отказано в доступе")
+			return
+		}
+		audit.Warn("права админа получены по токену")
+		s.bot.SendMessage(userId, "права админа выданы")
 	}
 
 	//проверили что пользователь админ
-	userId := upd.Message.From.ID
-	f := s.isAdmin(userId)
-	if !f {
+	if !s.isAdmin(userId) {
+		audit.Warn("попытка доступа к админ меню")
 		s.bot.SendMessage(userId, "отказано в доступе")
+		return
 	}
 
 	//генерируем клавиатуру
-	s.bot.SendKeyboard(userId, "меню:", GetAdminMenu())
+	s.adminMenu.Show(userId, 0)
+}
+
+func (s *Server) isAdmin(userId int64) bool {
+	return s.service.IsAdmin(userId)
+}
+
+// admHandleCallbackQuery нажатие кнопки из пространства имен adm, админ меню доступно только в личке
+func (s *Server) admHandleCallbackQuery(adminId int64, action, data string) {
+	if err := s.adminMenu.Handle(action, &admin.Context{AdminId: adminId, Args: data}); err != nil {
+		logrus.Errorf("ошибка действия админ меню %s: %v", action, err)
+		s.bot.SendMessage(adminId, "ошибка: "+err.Error())
+	}
+}
+
+// коды встроенных действий
+const (
+	admActionChannels   = "channels"
+	admActionChannel    = "channel"
+	admActionChanRename = "channel_rename"
+	admActionChanRemove = "channel_remove"
+	admActionUsers      = "users"
+	admActionUserFind   = "user_find"
+	admActionRoles      = "roles"
+	admActionRoleGrant  = "role_grant"
+	admActionRoleRevoke = "role_revoke"
+	admActionAdmins     = "admins"
+	admActionAdminAdd   = "admin_add"
+	admActionAdminDel   = "admin_remove"
+	admActionBroadcast  = "broadcast"
+	admActionStats      = "stats"
+	admActionReload     = "reload"
+)
+
+const (
+	admFormRoleGrant  = "adm_role_grant"
+	admFormRoleRevoke = "adm_role_revoke"
+
+	admFormAdminAdd    = "adm_admin_add"
+	admFormAdminRemove = "adm_admin_remove"
+
+	admFormChannelRename = "adm_channel_rename"
+
+	admFormUserFind  = "adm_user_find"
+	admFormBroadcast = "adm_broadcast"
+)
+
+// registerAdminMenu встроенные действия, затем действия из конфига
+func (s *Server) registerAdminMenu() *admin.Menu {
+	menu := admin.NewMenu(s.bot, s.config.Admin.PageSize)
+
+	reply := func(text func() string) admin.Handler {
+		return func(ctx *admin.Context) error {
+			return s.bot.SendMessage(ctx.AdminId, text())
+		}
+	}
+	withKeyboard := func(text func() string, kb b.MeshInlineKeyboard) admin.Handler {
+		return func(ctx *admin.Context) error {
+			return s.bot.SendKeyboard(ctx.AdminId, text(), kb)
+		}
+	}
+	form := func(name string) admin.Handler {
+		return func(ctx *admin.Context) error {
+			return s.formWorker.StartForm(name, ctx.AdminId, nil)
+		}
+	}
+	submenu := func(buttons ...b.MeshInlineButton) b.MeshInlineKeyboard {
+		return b.MeshInlineKeyboard{Rows: [][]b.MeshInlineButton{buttons}}
+	}
+
+	actions := []admin.Action{
+		{Code: admActionChannels, Title: "Каналы", Handler: s.admChannels},
+		{Code: admActionUsers, Title: "Пользователи", Handler: withKeyboard(s.admFormatUsersStats,
+			submenu(admin.Button("Найти по id", admActionUserFind, "")))},
+		{Code: admActionRoles, Title: "Роли", Handler: withKeyboard(s.admFormatRolesList,
+			submenu(admin.Button("Выдать роль", admActionRoleGrant, ""), admin.Button("Забрать роль", admActionRoleRevoke, "")))},
+		{Code: admActionAdmins, Title: "Админы", Handler: withKeyboard(s.admFormatAdminsList,
+			submenu(admin.Button("Добавить админа", admActionAdminAdd, ""), admin.Button("Удалить админа", admActionAdminDel, "")))},
+		{Code: admActionBroadcast, Title: "Рассылка", Handler: form(admFormBroadcast)},
+		{Code: admActionStats, Title: "Статистика", Handler: reply(s.admFormatStats)},
+		{Code: admActionReload, Title: "Перезагрузка", Handler: s.admReload},
+
+		{Code: admActionChannel, Hidden: true, Handler: s.admChannel},
+		{Code: admActionChanRename, Hidden: true, Handler: func(ctx *admin.Context) error {
+			return s.formWorker.StartFormWithData(admFormChannelRename, ctx.AdminId, nil, map[string]string{"chan_id": ctx.Args})
+		}},
+		{Code: admActionChanRemove, Hidden: true, Handler: s.admChannelRemove},
+		{Code: admActionUserFind, Hidden: true, Handler: form(admFormUserFind)},
+		{Code: admActionRoleGrant, Hidden: true, Handler: form(admFormRoleGrant)},
+		{Code: admActionRoleRevoke, Hidden: true, Handler: form(admFormRoleRevoke)},
+		{Code: admActionAdminAdd, Hidden: true, Handler: form(admFormAdminAdd)},
+		{Code: admActionAdminDel, Hidden: true, Handler: form(admFormAdminRemove)},
+	}
+
+	for _, a := range actions {
+		if err := menu.Register(a); err != nil {
+			logrus.Errorf("действие админ меню %s пропущено: %v", a.Code, err)
+		}
+	}
+
+	// действия на луа из конфига
+	for _, a := range s.config.Admin.Actions {
+		if err := menu.Register(admin.Action{Code: a.Name, Title: a.Title, Handler: s.admScriptAction(a)}); err != nil {
+			logrus.Errorf("действие админ меню %s пропущено: %v", a.Name, err)
+		}
+	}
+
+	s.registerAdminForms()
+
+	return menu
+}
 
-	//TODO как обработать нажатие именно по этой клавиатуре(расширить конфиг кнопок? и изменить обрабокту колюэков с тг)
-	//тут надо создать меню с кнопками, которые будут запускать разные штуки
+// admScriptAction запускает скрипт, ctx.cb_data.script - имя действия, ctx.cb_data.data - данные кнопки
+func (s *Server) admScriptAction(a c.AdminAction) admin.Handler {
+	return func(ctx *admin.Context) error {
+		lCtx := l.LuaContext{
+			ChatId: ctx.AdminId,
+			FromId: ctx.AdminId,
+			CbData: l.LuaCbData{Script: a.Name, Data: ctx.Args},
+		}
+		return s.le.ExecuteScript(a.Script, lCtx)
+	}
+}
 
-	//Одна из кнопок будет запускать форму, форма может собирать данные как раньшше, отличается только шаги с клавиатурой и выходной скрипт
+// admReload перезагрузка ждет окончания текущего обновления, поэтому идет в отдельной горутине
+func (s *Server) admReload(ctx *admin.Context) error {
+	adminId := ctx.AdminId
+	go func() {
+		text := "конфиг и скрипты перезагружены"
+		if err := s.Reload(); err != nil {
+			logrus.WithField("admin_id", adminId).Errorf("ошибка перезагрузки: %v", err)
+			text = "перезагрузка не удалась, работает старая версия: " + err.Error()
+		} else {
+			logrus.WithField("admin_id", adminId).Warn("конфиг и скрипты перезагружены из админ меню")
+		}
 
-	//для кейса с каналами необходимо чтоб он создал кнопку с настрйокой каналов по нажатию кнопки запускалась форма
-	//после выполнения формы надо будет запустить гошный код
+		if err := s.bot.SendMessage(adminId, text); err != nil {
+			logrus.Errorf("ошибка отправки результата перезагрузки: %v", err)
+		}
+	}()
+	return nil
 }
 
-func GetAdminMenu() b.MeshInlineKeyboard {
-	var keyboard b.MeshInlineKeyboard
+// registerAdminForms внутренние формы админ меню
+func (s *Server) registerAdminForms() {
+	number := map[string]any{"type": "number"}
 
-	// Первый ряд
-	row1 := []b.MeshInlineButton{
-		{
-			Text:         "Каналы",
-			Script:       "0",
-			CustomCbData: "channels",
-		},
+	stages := func() []c.FormStage {
+		return []c.FormStage{
+			{Field: "user_id", Message: "Введите id пользователя", Validation: &number},
+			{Field: "role", Message: "Введите роль (" + strings.Join(s.roleNames(), ", ") + ")"},
+		}
 	}
-	keyboard.Rows = append(keyboard.Rows, row1)
 
-	return keyboard
+	s.formWorker.RegisterForm(&c.Form{Name: admFormRoleGrant, Stages: stages()}, func(userID int64, data map[string]interface{}) {
+		s.admChangeRole(userID, data, s.service.SetRole, "роль выдана")
+	})
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormRoleRevoke, Stages: stages()}, func(userID int64, data map[string]interface{}) {
+		s.admChangeRole(userID, data, s.service.RemoveRole, "роль забрана")
+	})
+
+	userStages := []c.FormStage{{Field: "user_id", Message: "Введите id пользователя", Validation: &number}}
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormAdminAdd, Stages: userStages}, func(userID int64, data map[string]interface{}) {
+		s.admChangeAdmin(userID, data, func(id int64) error { return s.service.AddAdmin(id, userID) }, "админ добавлен")
+	})
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormAdminRemove, Stages: userStages}, func(userID int64, data map[string]interface{}) {
+		s.admChangeAdmin(userID, data, func(id int64) error {
+			if s.config.Bot.IsConfigAdmin(id) {
+				return fmt.Errorf("админ задан в конфиге")
+			}
+			return s.service.RemoveAdmin(id)
+		}, "админ удален")
+	})
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormChannelRename, Stages: []c.FormStage{
+		{Field: "code", Message: "Введите новый код канала (латиница, цифры и _)"},
+	}}, func(userID int64, data map[string]interface{}) {
+		chanId, err := strconv.ParseInt(fmt.Sprint(data["chan_id"]), 10, 64)
+		if err != nil {
+			s.bot.SendMessage(userID, "некорректный id канала")
+			return
+		}
+
+		code := strings.TrimSpace(fmt.Sprint(data["code"]))
+		if err := s.service.SetChannelCode(chanId, code); err != nil {
+			s.bot.SendMessage(userID, "ошибка: "+err.Error())
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{"admin_id": userID, "chan_id": chanId, "code": code}).Info("код канала изменен")
+		s.bot.SendMessage(userID, "код канала изменен на "+code)
+	})
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormUserFind, Stages: userStages}, func(userID int64, data map[string]interface{}) {
+		s.bot.SendMessage(userID, s.admFormatUser(fmt.Sprint(data["user_id"])))
+	})
+
+	s.formWorker.RegisterForm(&c.Form{Name: admFormBroadcast, Stages: []c.FormStage{
+		{Field: "text", Message: "Введите текст рассылки"},
+	}}, func(userID int64, data map[string]interface{}) {
+		text := fmt.Sprint(data["text"])
+		s.bot.SendMessage(userID, "рассылка запущена")
+
+		// рассылка долгая, не блокируем обработку обновлений
+		go func() {
+			sent, failed, err := s.service.Broadcast(text)
+			if err != nil {
+				logrus.Errorf("ошибка рассылки: %v", err)
+				s.bot.SendMessage(userID, "ошибка рассылки: "+err.Error())
+				return
+			}
+			logrus.WithFields(logrus.Fields{"admin_id": userID, "sent": sent, "failed": failed}).Info("рассылка завершена")
+			s.bot.SendMessage(userID, fmt.Sprintf("рассылка завершена: доставлено %d, ошибок %d", sent, failed))
+		}()
+	})
 }
 
-func (s *Server) isAdmin(userId int64) bool {
-	return userId == s.config.Bot.AdminId
+func (s *Server) admChangeAdmin(adminId int64, data map[string]interface{}, change func(int64) error, done string) {
+	userId, err := strconv.ParseInt(fmt.Sprint(data["user_id"]), 10, 64)
+	if err != nil {
+		s.bot.SendMessage(adminId, "некорректный id пользователя")
+		return
+	}
+
+	if err := change(userId); err != nil {
+		logrus.Errorf("ошибка изменения админа %d: %v", userId, err)
+		s.bot.SendMessage(adminId, "ошибка: "+err.Error())
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"admin_id": adminId, "user_id": userId}).Warn(done)
+	s.bot.SendMessage(adminId, done)
 }
 
-func (s *Server) admHandleCallbackQuery(chatId int64, data string) {
-	if data == "channels" {
-		s.bot.SendMessage(chatId, s.admFormatChannelsList())
+func (s *Server) admChangeRole(adminId int64, data map[string]interface{}, change func(int64, string) error, done string) {
+	userId, err := strconv.ParseInt(fmt.Sprint(data["user_id"]), 10, 64)
+	if err != nil {
+		s.bot.SendMessage(adminId, "некорректный id пользователя")
+		return
 	}
+
+	role := strings.TrimSpace(fmt.Sprint(data["role"]))
+	if _, ok := s.config.Roles[role]; !ok {
+		s.bot.SendMessage(adminId, "роль "+role+" не объявлена")
+		return
+	}
+
+	if err := change(userId, role); err != nil {
+		logrus.Errorf("ошибка изменения роли %s пользователя %d: %v", role, userId, err)
+		s.bot.SendMessage(adminId, "ошибка: "+err.Error())
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"admin_id": adminId, "user_id": userId, "role": role}).Info(done)
+	s.bot.SendMessage(adminId, done)
 }
 
-func (s *Server) admFormatChannelsList() string {
-	items, err := s.service.GetChannels()
+func (s *Server) roleNames() []string {
+	names := make([]string, 0, len(s.config.Roles))
+	for name := range s.config.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) admFormatAdminsList() string {
+	ids, err := s.service.GetAdmins()
 	if err != nil {
-		return "ошибка получения каналов " + err.Error()
+		return "ошибка получения админов " + err.Error()
 	}
 
 	sb := strings.Builder{}
-	sb.WriteString("Подключенные каналы: (название - код для скриптов)\n")
-	for _, channel := range items {
-		sb.WriteString(fmt.Sprintf("%s - %s", channel["title"], channel["code"]))
+	sb.WriteString("Админы:\n")
+	for _, id := range ids {
+		mark := ""
+		if s.config.Bot.IsConfigAdmin(id) {
+			mark = " (конфиг)"
+		}
+		sb.WriteString(fmt.Sprintf("%d%s\n", id, mark))
 	}
 
 	return sb.String()
 }
+
+func (s *Server) admFormatRolesList() string {
+	if len(s.config.Roles) == 0 {
+		return "роли не объявлены в конфиге"
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("Роли:\n")
+	for _, name := range s.roleNames() {
+		sb.WriteString(fmt.Sprintf("%s - %s\n", name, s.config.Roles[name].Description))
+	}
+
+	return sb.String()
+}
+
+func (s *Server) admFormatUsersStats() string {
+	total, active, err := s.service.UsersStats(time.Now().Add(-24 * time.Hour).Unix())
+	if err != nil {
+		return "ошибка получения пользователей " + err.Error()
+	}
+
+	return fmt.Sprintf("Пользователей: %d\nАктивных за сутки: %d", total, active)
+}
+
+func (s *Server) admFormatUser(rawId string) string {
+	userId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return "некорректный id пользователя"
+	}
+
+	user, err := s.service.GetUser(userId)
+	if err != nil {
+		return "ошибка получения пользователя " + err.Error()
+	}
+	if user == nil {
+		return "пользователь не найден"
+	}
+
+	roles, err := s.service.GetRoles(userId)
+	if err != nil {
+		logrus.Errorf("ошибка получения ролей %d: %v", userId, err)
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("id: %d\n", userId))
+	sb.WriteString(fmt.Sprintf("username: %v\n", user["username"]))
+	sb.WriteString(fmt.Sprintf("имя: %v %v\n", user["first_name"], user["last_name"]))
+	sb.WriteString(fmt.Sprintf("сообщений: %v, нажатий: %v\n", user["messages"], user["callbacks"]))
+	if seen, ok := user["last_seen"]; ok {
+		if ts, err := strconv.ParseInt(fmt.Sprint(seen), 10, 64); err == nil {
+			sb.WriteString(fmt.Sprintf("последняя активность: %s\n", time.Unix(ts, 0).Format(time.DateTime)))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("роли: %s\n", strings.Join(roles, ", ")))
+	if s.isAdmin(userId) {
+		sb.WriteString("админ\n")
+	}
+
+	return sb.String()
+}
+
+func (s *Server) admFormatStats() string {
+	total, active, err := s.service.UsersStats(time.Now().Add(-24 * time.Hour).Unix())
+	if err != nil {
+		return "ошибка получения статистики " + err.Error()
+	}
+
+	channels, err := s.service.GetChannels()
+	if err != nil {
+		logrus.Errorf("ошибка получения каналов: %v", err)
+	}
+
+	admins, err := s.service.GetAdmins()
+	if err != nil {
+		logrus.Errorf("ошибка получения админов: %v", err)
+	}
+
+	return fmt.Sprintf("Пользователей: %d\nАктивных за сутки: %d\nКаналов: %d\nАдминов: %d",
+		total, active, len(channels), len(admins))
+}
+
+// admChannels список каналов кнопками, по нажатию - управление каналом
+func (s *Server) admChannels(ctx *admin.Context) error {
+	items, err := s.service.GetChannels()
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return s.bot.SendMessage(ctx.AdminId, "Бот не добавлен ни в один канал")
+	}
+
+	var kb b.MeshInlineKeyboard
+	for _, channel := range items {
+		text := fmt.Sprintf("%v - %v", channel["title"], channel["code"])
+		kb.Rows = append(kb.Rows, []b.MeshInlineButton{admin.Button(text, admActionChannel, formatId(channel["chan_id"]))})
+	}
+
+	return s.bot.SendKeyboard(ctx.AdminId, "Подключенные каналы: (название - код для скриптов)", kb)
+}
+
+func (s *Server) admChannel(ctx *admin.Context) error {
+	chanId, err := strconv.ParseInt(ctx.Args, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	channel, err := s.service.GetChannel(chanId)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return s.bot.SendMessage(ctx.AdminId, "канал не найден")
+	}
+
+	kb := b.MeshInlineKeyboard{Rows: [][]b.MeshInlineButton{{
+		admin.Button("Изменить код", admActionChanRename, ctx.Args),
+		admin.Button("Удалить", admActionChanRemove, ctx.Args),
+	}}}
+
+	return s.bot.SendKeyboard(ctx.AdminId, fmt.Sprintf("%v\nкод: %v", channel["title"], channel["code"]), kb)
+}
+
+func (s *Server) admChannelRemove(ctx *admin.Context) error {
+	chanId, err := strconv.ParseInt(ctx.Args, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if err := s.service.RemoveChannel(chanId); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{"admin_id": ctx.AdminId, "chan_id": chanId}).Warn("канал удален")
+	return s.bot.SendMessage(ctx.AdminId, "канал удален")
+}
+
+// formatId числа из хранилища могут прийти как float64
+func formatId(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatInt(int64(n), 10)
+	default:
+		return fmt.Sprint(n)
+	}
+}
@@ -3,10 +3,11 @@ package server
 import (
 	"fmt"
 	"strings"
-	"sync"
 
 	b "github.com/end1essrage/indigo-core/bot"
 	c "github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/interceptor"
+	l "github.com/end1essrage/indigo-core/lua"
 	m "github.com/end1essrage/indigo-core/mapper"
 	"github.com/end1essrage/indigo-core/service"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -29,6 +30,36 @@ func (s *Server) HandleUpdate(update *tgbotapi.Update) {
 		s.mu.Unlock()
 	}()
 
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+
+	// на любое нажатие отвечаем один раз в конце обработки, даже если обновление отбросили
+	if update.CallbackQuery != nil {
+		defer s.bot.FinishCallback(update.CallbackQuery.ID)
+	}
+
+	// данные кнопки могут быть упакованы или лежать в кэше под токеном, подделанные отбрасываются
+	var cb b.CbData
+	if update.CallbackQuery != nil {
+		var err error
+		if cb, err = s.bot.ResolveCallback(update.CallbackQuery); err != nil {
+			logrus.Warnf("callback %s: %v", update.CallbackQuery.ID, err)
+			s.bot.AnswerCallback(update.CallbackQuery.ID, "Кнопка устарела, повторите действие", true)
+			return
+		}
+	}
+
+	// листание длинных клавиатур работает и во время заполнения формы
+	if update.CallbackQuery != nil {
+		cbData := m.FromCallbackDataToLuaCbData(update.CallbackQuery.Data)
+		if namespace, action, ok := b.ParseNamespacedScript(cbData.Script); ok && namespace == b.CbNamespace_Page {
+			if err := s.bot.HandlePageCallback(update.CallbackQuery, action, cbData.Data); err != nil {
+				logrus.Warnf("ошибка листания клавиатуры: %v", err)
+			}
+			return
+		}
+	}
+
 	// Формы
 	if s.formWorker.HasActiveForm(update) {
 		s.formWorker.HandleInput(update)
@@ -36,39 +67,16 @@ func (s *Server) HandleUpdate(update *tgbotapi.Update) {
 	}
 
 	//перехватчики
-	wg := &sync.WaitGroup{}
-
-	if len(s.interceptors) > 0 {
-		for k, v := range s.interceptors {
-			switch k {
-			case c.AffectMode_All:
-				for _, f := range v {
-					wg.Add(1)
-					go func() {
-						defer wg.Done()
-						f.Use(update)
-					}()
-				}
-			case c.AffectMode_Text:
-				if update.Message.IsCommand() || update.CallbackQuery != nil {
-					continue
-				}
-				for _, f := range v {
-					wg.Add(1)
-					go func() {
-						defer wg.Done()
-						f.Use(update)
-					}()
-				}
-			}
-		}
+	ictx := interceptor.NewContext(update)
+	if !s.runInterceptors(ictx) {
+		return
 	}
 
-	wg.Wait()
-
-	// Кнопки
+	// Кнопки (у инлайн сообщений нет Message, их не обрабатываем)
 	if update.CallbackQuery != nil {
-		s.handleCallbackQuery(update.CallbackQuery)
+		if update.CallbackQuery.Message != nil {
+			s.handleCallbackQuery(update.CallbackQuery, cb, ictx.Data)
+		}
 		return
 	}
 
@@ -77,31 +85,166 @@ func (s *Server) HandleUpdate(update *tgbotapi.Update) {
 		s.handleChatMember(update.MyChatMember)
 	}
 
-	// Команды
-	if update.Message != nil && update.Message.IsCommand() {
-		s.handleCommand(update)
+	// Команды (в каналах приходят как ChannelPost)
+	if (update.Message != nil && update.Message.IsCommand()) || (update.ChannelPost != nil && update.ChannelPost.IsCommand()) {
+		s.handleCommand(update, ictx.Data)
+		return
+	}
+
+	// нажатия reply кнопок приходят обычным сообщением (текст, контакт или геопозиция)
+	if update.Message != nil {
+		if d, ok := s.bot.ResolveReplyButton(update.Message); ok {
+			s.handleReplyButton(update, d, ictx.Data)
+			return
+		}
+	}
+
+	// сообщения пользователя в состоянии диалога получает скрипт состояния
+	if update.Message != nil && s.handleState(update, ictx.Data) {
+		return
+	}
+
+	// Вложения
+	if update.Message != nil {
+		if media := m.MessageMedia(update.Message); media != nil {
+			s.handleMedia(update, media, ictx.Data)
+		}
 	}
 }
 
-// обработка добавления/удаления из чата
-func (s *Server) handleChatMember(upd *tgbotapi.ChatMemberUpdated) {
-	if upd.NewChatMember.Status != "administrator" {
+// handleMedia запускает первый подходящий по типу обработчик вложений
+func (s *Server) handleMedia(upd *tgbotapi.Update, media *l.LuaMedia, data map[string]interface{}) {
+	for _, h := range s.config.Media.Handlers {
+		if h.Kind != "" && string(h.Kind) != media.Kind {
+			continue
+		}
+
+		lCtx := m.FromUpdateToLuaContext(upd)
+		lCtx.Data = data
+
+		if !s.checkAccess(lCtx.FromId, lCtx.ChatId, h.Roles) {
+			return
+		}
+
+		if err := s.le.ExecuteScript(h.Script, lCtx); err != nil {
+			logrus.Errorf("Media script error: %v", err)
+		}
 		return
 	}
+}
+
+// handleState запускает скрипт текущего состояния диалога, false - состояния нет
+func (s *Server) handleState(upd *tgbotapi.Update, data map[string]interface{}) bool {
+	msg := upd.Message
+	if msg.From == nil {
+		return false
+	}
+
+	name, stateData, err := s.states.Get(msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		logrus.Errorf("ошибка чтения состояния: %v", err)
+		return false
+	}
+	if name == "" {
+		return false
+	}
+
+	st := s.config.States[name]
+	if st == nil {
+		// состояние убрали из конфига - сбрасываем, чтобы пользователь не завис
+		logrus.Warnf("состояние %s не найдено в конфиге, сбрасываем", name)
+		if err := s.states.Clear(msg.Chat.ID, msg.From.ID); err != nil {
+			logrus.Errorf("ошибка сброса состояния: %v", err)
+		}
+		return false
+	}
+
+	lCtx := m.FromUpdateToLuaContext(upd)
+	lCtx.Data = data
+	lCtx.State = &l.LuaDialogState{Name: name, Data: stateData}
+
+	if !s.checkAccess(lCtx.FromId, lCtx.ChatId, st.Roles) {
+		return true
+	}
+
+	if err := s.le.ExecuteScript(st.Script, lCtx); err != nil {
+		logrus.Errorf("State script error: %v", err)
+	}
+	return true
+}
+
+// runInterceptors последовательно запускает перехватчики, false - обработку надо прервать
+func (s *Server) runInterceptors(ictx *interceptor.Context) bool {
+	for _, group := range s.interceptors {
+		if !group.matcher(ictx.Update) {
+			continue
+		}
+
+		for _, f := range group.chain {
+			verdict, err := f.Use(ictx)
+			if err != nil {
+				logrus.Errorf("Interceptor (%s) error: %v", group.affects, err)
+				continue
+			}
+
+			if verdict == interceptor.Verdict_Stop {
+				logrus.Debugf("update %d stopped by interceptor", ictx.Update.UpdateID)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// обработка добавления/удаления из чата
+func (s *Server) handleChatMember(upd *tgbotapi.ChatMemberUpdated) {
+	req := service.BotAdminRequest{FromId: upd.From.ID, ChannelId: upd.Chat.ID, Title: upd.Chat.Title}
 
-	go s.service.HandleBotAdd(service.BotAdminRequest{FromId: upd.From.ID, ChannelId: upd.Chat.ID, Title: upd.Chat.Title})
+	switch {
+	case upd.NewChatMember.IsAdministrator():
+		go s.service.HandleBotAdd(req)
+	// вышел, удалили или сняли права админа - писать в канал бот больше не может
+	case upd.NewChatMember.HasLeft(), upd.NewChatMember.WasKicked(), upd.OldChatMember.IsAdministrator():
+		go s.service.HandleBotRemove(req)
+	}
 }
 
-func (s *Server) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
+// handleCallbackQuery d - данные проверенные реестром кнопок, а не присланные клиентом
+func (s *Server) handleCallbackQuery(query *tgbotapi.CallbackQuery, d b.CbData, data map[string]interface{}) {
 	// формируем контекст
 	lCtx := m.FromCallbackQueryToLuaContext(query)
+	lCtx.Data = data
+	lCtx.CbData = m.FromCbData(d)
+
+	//удаляем сообщение с клавиатурой, оставляем или убираем только клавиатуру
+	s.bot.ApplyPress(query, lCtx.CbData.OnPress)
+
+	s.runButton(lCtx)
+}
+
+func (s *Server) handleReplyButton(upd *tgbotapi.Update, d b.CbData, data map[string]interface{}) {
+	lCtx := m.FromUpdateToLuaContext(upd)
+	lCtx.Data = data
+	lCtx.CbData = m.FromCbData(d)
+
+	s.runButton(lCtx)
+}
+
+// runButton общая обработка нажатия inline и reply кнопок
+// данные только из реестра кнопок или маршрутов reply клавиатур, скрипт из данных клиента сюда не попадает
+func (s *Server) runButton(lCtx l.LuaContext) {
+	if !s.checkAccess(lCtx.FromId, lCtx.ChatId, lCtx.CbData.Roles) {
+		return
+	}
+
+	// внутренние кнопки (adm:<действие>)
+	if namespace, action, ok := b.ParseNamespacedScript(lCtx.CbData.Script); ok {
+		s.handleInternalCallback(namespace, action, lCtx)
+		return
+	}
 
-	//удаляем сообщение с клавиатурой
-	s.bot.DeleteMsg(lCtx.ChatId, query.Message.MessageID)
 	switch lCtx.CbData.Script {
-	// 0 - особый знак что это внутренняя кнопка админская
-	case "0":
-		s.admHandleCallbackQuery(lCtx.ChatId, lCtx.CbData.Data)
 	//если есть скрипт запускаем
 	case "":
 		//если скрипт вообще не передан ничего не делаем
@@ -113,32 +256,87 @@ func (s *Server) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	}
 }
 
-func (s *Server) handleCommand(upd *tgbotapi.Update) {
-	chatId := upd.Message.Chat.ID
+func (s *Server) handleInternalCallback(namespace, action string, lCtx l.LuaContext) {
+	switch namespace {
+	case b.CbNamespace_Admin:
+		if !s.isAdmin(lCtx.FromId) {
+			logrus.WithFields(logrus.Fields{"user_id": lCtx.FromId, "action": action}).Warn("попытка нажатия админской кнопки")
+			s.bot.SendMessage(lCtx.ChatId, s.accessDeniedText())
+			return
+		}
+		s.admHandleCallbackQuery(lCtx.FromId, action, lCtx.CbData.Data)
+	case b.CbNamespace_Form:
+		// кнопки выбора после завершения или сброса формы
+		logrus.Debugf("нажатие кнопки неактивной формы пользователем %d", lCtx.FromId)
+	default:
+		logrus.Warnf("неизвестное пространство имен кнопки %s", namespace)
+	}
+}
+
+func (s *Server) handleCommand(upd *tgbotapi.Update, data map[string]interface{}) {
+	msg := m.UpdateMessage(upd)
+	chatId := msg.Chat.ID
+	use := chatUse(msg.Chat)
+
+	// в группах команда может быть адресована другому боту
+	if !s.isAddressedToBot(msg) {
+		return
+	}
+
+	// в каналах нет отправителя
+	var userId int64
+	if msg.From != nil {
+		userId = msg.From.ID
+	}
 
 	// Добавить проверку на валидатере на занятые имена
 
 	// атвообработка команды хелп,мб стоит дать возможность оверрайдить
-	if upd.Message.Command() == "adm" {
+	if msg.Command() == "adm" {
 		s.handleAdm(upd)
 		return
 	}
 
-	if upd.Message.Command() == "help" {
-		s.bot.SendMessage(chatId, s.formatHelpMessage())
+	if msg.Command() == "help" {
+		s.bot.SendMessage(chatId, s.formatHelpMessage(use))
 		return
 	}
 
 	//ищем команду
-	cmd := s.config.Commands[upd.Message.Command()]
+	cmd := s.config.Commands[msg.Command()]
 	if cmd == nil {
-		s.bot.SendMessage(chatId, "Unknown command: "+upd.Message.Command())
+		// в группах и каналах чужие команды не комментируем
+		if use == c.CmdUse_Private {
+			s.bot.SendMessage(chatId, "Unknown command: "+msg.Command())
+		}
+		return
+	}
+
+	// команда не предназначена для этого типа чата
+	if !cmd.Use.Allows(use) {
+		logrus.Debugf("команда %s недоступна в чате типа %s", cmd.Name, use)
+		if use != c.CmdUse_Channel {
+			s.bot.SendMessage(chatId, "Команда недоступна в этом чате")
+		}
+		return
+	}
+
+	// команда закрыта ролями - скрипты не запускаем
+	if !s.checkAccess(userId, chatId, cmd.Roles) {
 		return
 	}
 
+	// форма может требовать свои роли
+	if cmd.Form != nil && *cmd.Form != "" {
+		if form := s.config.Forms[*cmd.Form]; form != nil && !s.checkAccess(userId, chatId, form.Roles) {
+			return
+		}
+	}
+
 	// Выполняем скрипт
 	if cmd.Script != nil && *cmd.Script != "" {
-		ctx := m.FromTgUpdateToLuaContext(upd)
+		ctx := m.FromUpdateToLuaContext(upd)
+		ctx.Data = data
 		if err := s.le.ExecuteScript(*cmd.Script, ctx); err != nil {
 			logrus.Errorf("Command script error: %v", err)
 		}
@@ -149,21 +347,18 @@ func (s *Server) handleCommand(upd *tgbotapi.Update) {
 		kb := s.config.Keyboards[*cmd.Keyboard]
 		if kb == nil {
 			logrus.Errorf("keyboard '%s' not found", *cmd.Keyboard)
+		} else {
+			if _, err := s.bot.SendOpts(chatId, *kb.Message, b.ParseKeyboard(kb), b.SendOptions{}); err != nil {
+				logrus.Errorf("Error sending keyboard: %v", err)
+			}
 		}
-
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			b.CreateInlineKeyboard(b.ParseInlineKeyboard(kb))...,
-		)
-
-		msg := tgbotapi.NewMessage(chatId, *kb.Message)
-		msg.ReplyMarkup = &keyboard
-
-		s.bot.Send(msg)
 	}
 
-	// Запускаем форму
+	// Запускаем форму, формы привязаны к пользователю и работают только в личке
 	if cmd.Form != nil && *cmd.Form != "" {
-		if err := s.formWorker.StartForm(*cmd.Form, upd.Message.From.ID, upd); err != nil {
+		if use != c.CmdUse_Private {
+			logrus.Warnf("форма %s не запускается в чате типа %s", *cmd.Form, use)
+		} else if err := s.formWorker.StartForm(*cmd.Form, userId, upd); err != nil {
 			logrus.Errorf("Form start error: %v", err)
 			s.bot.SendMessage(chatId, "Failed to start form: "+err.Error())
 		}
@@ -171,14 +366,44 @@ func (s *Server) handleCommand(upd *tgbotapi.Update) {
 
 	// Шлем ответ
 	if cmd.Reply != nil && *cmd.Reply != "" {
-		s.bot.SendMessage(chatId, *cmd.Reply)
+		if cmd.RemoveKeyboard {
+			if _, err := s.bot.SendOpts(chatId, *cmd.Reply, b.MeshReplyKeyboard{Remove: true}, b.SendOptions{}); err != nil {
+				logrus.Errorf("Error removing keyboard: %v", err)
+			}
+		} else {
+			s.bot.SendMessage(chatId, *cmd.Reply)
+		}
 	}
 }
 
-func (s *Server) formatHelpMessage() string {
+// chatUse тип чата в терминах конфига команд
+func chatUse(chat *tgbotapi.Chat) c.CmdUse {
+	switch {
+	case chat.IsChannel():
+		return c.CmdUse_Channel
+	case chat.IsGroup(), chat.IsSuperGroup():
+		return c.CmdUse_Group
+	}
+	return c.CmdUse_Private
+}
+
+// isAddressedToBot /cmd и /cmd@наш_бот - наши, /cmd@другой_бот - нет
+func (s *Server) isAddressedToBot(msg *tgbotapi.Message) bool {
+	command := msg.CommandWithAt()
+	at := strings.Index(command, "@")
+	if at < 0 {
+		return true
+	}
+	return strings.EqualFold(command[at+1:], s.bot.UserName())
+}
+
+func (s *Server) formatHelpMessage(use c.CmdUse) string {
 	sb := strings.Builder{}
 	sb.WriteString("Available commands:\n")
 	for _, cmd := range s.config.Commands {
+		if !cmd.Use.Allows(use) {
+			continue
+		}
 		sb.WriteString(fmt.Sprintf("/%s - %s\n", cmd.Name, cmd.Description))
 	}
 	return sb.String()
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	c "github.com/end1essrage/indigo-core/config"
+	"github.com/sirupsen/logrus"
+)
+
+// период проверки файлов если в конфиге не задан
+const defaultWatchInterval = 2 * time.Second
+
+// Reload перечитывает конфиг и скрипты, при ошибке валидации или компиляции остается старая версия
+// без перезапуска применяются роли, команды, клавиатуры, формы, состояния, перехватчики и обработчики медиа
+func (s *Server) Reload() error {
+	// перезагрузки идут по одной, иначе медленная может подменить новую версию старой
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+
+	loaded, err := c.LoadConfig(s.configPath, true)
+	if err != nil {
+		return fmt.Errorf("конфиг не применен: %w", err)
+	}
+
+	scripts, err := s.le.LoadScripts()
+	if err != nil {
+		return fmt.Errorf("скрипты не загружены: %w", err)
+	}
+
+	// все собирается до блокировки, под ней только подмена
+	s.reloadMu.RLock()
+	next := *s.config
+	s.reloadMu.RUnlock()
+
+	// роли меняются вместе с секциями, которые на них ссылаются и проверялись по ним
+	next.Roles = loaded.Roles
+	next.Commands = loaded.Commands
+	next.Keyboards = loaded.Keyboards
+	next.Forms = loaded.Forms
+	next.States = loaded.States
+	next.Interceptors = loaded.Interceptors
+	next.Media.Handlers = loaded.Media.Handlers
+	interceptors := registerInterceptors(s.le, s.service, &next)
+
+	if sections := restartSections(&next, loaded); len(sections) > 0 {
+		logrus.Warnf("изменения секций %v применятся после перезапуска", sections)
+	}
+
+	// ждем окончания обработки текущего обновления, скрипты и конфиг меняются вместе
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.le.SetScripts(scripts)
+	s.config = &next
+	s.interceptors = interceptors
+	s.formWorker.SetConfig(&next)
+	s.service.SetConfig(&next)
+
+	logrus.Infof("конфиг и скрипты перезагружены, скриптов: %d", len(scripts.Data))
+	return nil
+}
+
+// restartSections измененные секции, которые нельзя подменить на лету
+func restartSections(cur, loaded *c.Config) []string {
+	media := func(m c.MediaConfig) c.MediaConfig {
+		m.Handlers = nil
+		return m
+	}
+
+	checks := []struct {
+		name      string
+		cur, next any
+	}{
+		{"bot", cur.Bot, loaded.Bot},
+		{"cache", cur.Cache, loaded.Cache},
+		{"storage", cur.Storage, loaded.Storage},
+		{"sessions", cur.Sessions, loaded.Sessions},
+		{"reload", cur.Reload, loaded.Reload},
+		{"api", cur.HTTP, loaded.HTTP},
+		{"media", media(cur.Media), media(loaded.Media)},
+		{"modules", cur.Modules, loaded.Modules},
+		{"secrets", cur.Secrets, loaded.Secrets},
+		{"admin", cur.Admin, loaded.Admin},
+	}
+
+	var changed []string
+	for _, ch := range checks {
+		if !reflect.DeepEqual(ch.cur, ch.next) {
+			changed = append(changed, ch.name)
+		}
+	}
+	return changed
+}
+
+// Watch проверяет конфиг и скрипты раз в interval и перезагружает их после изменения
+func (s *Server) Watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	s.watchStop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := s.fingerprint()
+		changed := false
+		for {
+			select {
+			case <-s.watchStop:
+				return
+			case <-ticker.C:
+			}
+
+			// редакторы сохраняют файлы в несколько приемов, перезагружаем когда запись закончилась
+			if fp := s.fingerprint(); fp != last {
+				last = fp
+				changed = true
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			changed = false
+			if err := s.Reload(); err != nil {
+				logrus.Errorf("ошибка перезагрузки: %v", err)
+			}
+		}
+	}()
+
+	logrus.Infof("слежение за конфигом и скриптами, период %s", interval)
+}
+
+// fingerprint хэш имен, размеров и времени изменения файлов конфига и скриптов
+func (s *Server) fingerprint() uint64 {
+	h := fnv.New64a()
+	add := func(path string, info fs.FileInfo) {
+		fmt.Fprintf(h, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+
+	if info, err := os.Stat(s.configPath); err == nil {
+		add(s.configPath, info)
+	}
+
+	filepath.WalkDir(s.le.BasePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			add(path, info)
+		}
+		return nil
+	})
+
+	return h.Sum64()
+}
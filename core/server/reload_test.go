@@ -0,0 +1,136 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/end1essrage/indigo-core/config"
+	h "github.com/end1essrage/indigo-core/handler"
+	l "github.com/end1essrage/indigo-core/lua"
+	"github.com/end1essrage/indigo-core/service"
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+func writeFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	scripts := filepath.Join(dir, "scripts")
+	if err := os.Mkdir(scripts, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, configPath, "bot:\n  mode: \"polling\"\n")
+	writeFile(t, filepath.Join(scripts, "hello.lua"), `return "old"`)
+
+	config, err := c.LoadConfig(configPath, true)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	st, err := storage.NewFileStorage(filepath.Join(dir, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := l.NewLuaEngine(nil, nil, nil, nil, scripts, nil, nil, nil, nil)
+	s := &Server{le: le, config: config, configPath: configPath, formWorker: h.NewFormWorker(nil, nil, config, le, nil),
+		service: service.NewService(nil, st, nil, config)}
+
+	writeFile(t, configPath, "bot:\n  mode: \"polling\"\ncommands:\n  - name: \"start\"\n    script: \"hello\"\n")
+	writeFile(t, filepath.Join(scripts, "hello.lua"), `return "new"`)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if s.config.Commands["start"] == nil {
+		t.Error("commands were not reloaded")
+	}
+	if got, _ := le.ExecuteScriptWithResult("hello", l.LuaContext{}); got != "new" {
+		t.Errorf("scripts were not reloaded: %v", got)
+	}
+
+	// новая роль применяется вместе с командой, которая ее использует, и ее можно выдать
+	writeFile(t, configPath, "bot:\n  mode: \"polling\"\nroles:\n  - name: \"vip\"\ncommands:\n  - name: \"start\"\n    script: \"hello\"\n    roles: [\"vip\"]\n")
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, ok := s.config.Roles["vip"]; !ok {
+		t.Error("roles were not reloaded")
+	}
+	if err := s.service.SetRole(1, "vip"); err != nil {
+		t.Errorf("new role should be granted: %v", err)
+	}
+
+	// невалидный конфиг - остается прежняя версия конфига и скриптов
+	writeFile(t, configPath, "bot:\n  mode: \"carrier_pigeon\"\n")
+	writeFile(t, filepath.Join(scripts, "hello.lua"), `return "broken"`)
+	if err := s.Reload(); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if s.config.Commands["start"] == nil {
+		t.Error("old config should be kept")
+	}
+	if got, _ := le.ExecuteScriptWithResult("hello", l.LuaContext{}); got != "new" {
+		t.Errorf("old scripts should be kept: %v", got)
+	}
+
+	// скрипт с синтаксической ошибкой - не применяются ни скрипты, ни конфиг
+	writeFile(t, configPath, "bot:\n  mode: \"polling\"\n")
+	writeFile(t, filepath.Join(scripts, "hello.lua"), `return "newer"`)
+	writeFile(t, filepath.Join(scripts, "other.lua"), `if then`)
+	if err := s.Reload(); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Fatalf("expected compile error for other, got %v", err)
+	}
+	if s.config.Commands["start"] == nil {
+		t.Error("config should not change when scripts are broken")
+	}
+	if got, err := le.ExecuteScriptWithResult("hello", l.LuaContext{}); err != nil || got != "new" {
+		t.Errorf("old scripts should be kept: %v %v", got, err)
+	}
+}
+
+func TestReloadSerialized(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, configPath, "bot:\n  mode: \"polling\"\ncommands:\n  - name: \"start\"\n    script: \"hello\"\n")
+
+	config, err := c.LoadConfig(configPath, true)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	le := l.NewLuaEngine(nil, nil, nil, nil, t.TempDir(), nil, nil, nil, nil)
+	s := &Server{le: le, config: config, configPath: configPath, formWorker: h.NewFormWorker(nil, nil, config, le, nil),
+		service: service.NewService(nil, nil, nil, config)}
+
+	// перезагрузка не начинается, пока идет другая
+	s.reloading.Lock()
+	done := make(chan error)
+	go func() { done <- s.Reload() }()
+
+	select {
+	case <-done:
+		t.Fatal("reload should wait for the running one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.reloading.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+}
+
+func TestRestartSections(t *testing.T) {
+	cur := &c.Config{Bot: c.BotConfig{Mode: c.BotMode_Polling}}
+	next := &c.Config{Bot: c.BotConfig{Mode: c.BotMode_Webhook}, Media: c.MediaConfig{Handlers: []c.MediaHandler{{Script: "photo"}}}}
+
+	got := restartSections(cur, next)
+	if len(got) != 1 || got[0] != "bot" {
+		t.Errorf("restartSections = %v, want [bot]", got)
+	}
+}
@@ -4,84 +4,112 @@ import (
 	"sync"
 	"time"
 
+	"github.com/end1essrage/indigo-core/admin"
 	"github.com/end1essrage/indigo-core/api"
 	b "github.com/end1essrage/indigo-core/bot"
-	"github.com/end1essrage/indigo-core/config"
 	c "github.com/end1essrage/indigo-core/config"
 	h "github.com/end1essrage/indigo-core/handler"
 	"github.com/end1essrage/indigo-core/interceptor"
 	modules "github.com/end1essrage/indigo-core/interceptor/modules"
 	l "github.com/end1essrage/indigo-core/lua"
+	"github.com/end1essrage/indigo-core/media"
+	"github.com/end1essrage/indigo-core/receiver"
 	"github.com/end1essrage/indigo-core/service"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
 //при использовании в личке chat.Id == From.Id
 
-type Buffer interface {
-	GetString(key string) string
-	SetString(key string, val string) error
-	Exists(key string) bool
-}
-
 type Server struct {
 	le           *l.LuaEngine
 	bot          *b.TgBot
 	config       *c.Config
+	configPath   string
 	api          *api.API
 	formWorker   *h.FormWorker
+	states       *h.StateStore
 	service      *service.Service
-	interceptors map[c.AffectMode][]interceptor.Interceptor
+	interceptors []interceptorGroup
+	adminMenu    *admin.Menu
+	receiver     receiver.Receiver
 	stopping     bool
 	handling     bool
 	stopped      chan struct{}
 	mu           sync.Mutex
+	// обновление обрабатывается под чтением, перезагрузка подменяет конфиг под записью
+	reloadMu sync.RWMutex
+	// сигнал, слежение за файлами и админ меню могут запустить перезагрузку одновременно
+	reloading sync.Mutex
+	watchStop chan struct{}
 }
 
-func NewServer(le *l.LuaEngine, bot *b.TgBot, config *c.Config, buffer Buffer, service *service.Service) *Server {
+func NewServer(le *l.LuaEngine, bot *b.TgBot, config *c.Config, configPath string, sessions h.SessionStore, states *h.StateStore, service *service.Service, store media.Store) *Server {
 	s := &Server{
 		le:           le,
 		bot:          bot,
 		config:       config,
+		configPath:   configPath,
 		service:      service,
-		formWorker:   h.NewFormWorker(bot, buffer, config, le),
+		formWorker:   h.NewFormWorker(bot, sessions, config, le, store),
+		states:       states,
 		stopped:      make(chan struct{}),
-		interceptors: registerInterceptors(config.Interceptors),
+		interceptors: registerInterceptors(le, service, config),
 	}
 	if s.config.HTTP != nil {
 		s.api = api.New(s.le, s.config.HTTP)
 	}
+	s.adminMenu = s.registerAdminMenu()
 	return s
 }
 
-func registerInterceptors(inters []config.Interceptor) map[c.AffectMode][]interceptor.Interceptor {
-	result := make(map[c.AffectMode][]interceptor.Interceptor)
-	for _, inter := range inters {
+// группа перехватчиков из одного блока конфига
+type interceptorGroup struct {
+	affects c.AffectMode
+	matcher interceptor.Matcher
+	chain   []interceptor.Interceptor
+}
+
+// registerInterceptors сохраняет порядок из конфига, чтобы обработка была детерминированной
+func registerInterceptors(le *l.LuaEngine, svc *service.Service, cfg *c.Config) []interceptorGroup {
+	result := make([]interceptorGroup, 0, len(cfg.Interceptors))
+	for _, inter := range cfg.Interceptors {
+		matcher, err := interceptor.NewMatcher(le, inter)
+		if err != nil {
+			logrus.Errorf("перехватчик %s пропущен: %v", inter.Affects, err)
+			continue
+		}
+
 		//массив перехватчиков
 		arr := make([]interceptor.Interceptor, 0)
 
 		for _, s := range inter.Scripts {
-			arr = append(arr, interceptor.Script(s))
+			arr = append(arr, interceptor.Script(le, s))
 		}
 
 		for _, f := range inter.Modules {
 			switch {
 			case f == string(c.TRACK_USER):
-				arr = append(arr, modules.TrackUser())
+				arr = append(arr, modules.TrackUser(svc, cfg.Module(c.TRACK_USER)))
 			default:
 				logrus.Errorf("не существует модуля %s", f)
 			}
 		}
 
-		result[inter.Affects] = arr
+		result = append(result, interceptorGroup{affects: inter.Affects, matcher: matcher, chain: arr})
 	}
 
 	return result
 }
 
-func (s *Server) Start(updates tgbotapi.UpdatesChannel) {
+// Start запускает прием обновлений через поллинг или вебхук
+func (s *Server) Start(r receiver.Receiver) error {
+	updates, err := r.Start()
+	if err != nil {
+		return err
+	}
+	s.receiver = r
+
 	go func() {
 		for update := range updates {
 			s.HandleUpdate(&update)
@@ -95,17 +123,28 @@ func (s *Server) Start(updates tgbotapi.UpdatesChannel) {
 			}
 		}()
 	}
+
+	return nil
 }
 
 func (s *Server) Stop() {
+	// сначала перестаем принимать новые обновления
+	if s.receiver != nil {
+		s.receiver.Stop()
+	}
+
 	s.mu.Lock()
 	s.stopping = true
 	handling := s.handling
 	s.mu.Unlock()
 
+	if s.watchStop != nil {
+		close(s.watchStop)
+	}
 	if s.api != nil {
 		s.api.Stop()
 	}
+	s.formWorker.Stop()
 
 	if handling {
 		select {
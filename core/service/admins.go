@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+const adminsCollection = "admins"
+
+// IsAdmin админ из конфига или выданный через хранилище, ему доступны все роли
+// (0 - отправитель неизвестен, например пост в канале)
+func (s *Service) IsAdmin(userId int64) bool {
+	if userId == 0 {
+		return false
+	}
+	if s.cfg().Bot.IsConfigAdmin(userId) {
+		return true
+	}
+
+	_, err := s.storage.GetOne(context.TODO(), adminsCollection, userQuery(userId))
+	return err == nil
+}
+
+// HasAdmins есть ли у бота хоть один админ
+func (s *Service) HasAdmins() (bool, error) {
+	if s.cfg().Bot.AdminId != 0 || len(s.cfg().Bot.Admins) > 0 {
+		return true, nil
+	}
+
+	items, err := s.storage.Get(context.TODO(), adminsCollection, 1, &storage.Condition{Field: "user_id", Operator: ">", Value: float64(0)})
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return len(items) > 0, nil
+}
+
+// AddAdmin сохраняет админа в хранилище, addedBy - кто выдал права (0 - по токену)
+func (s *Service) AddAdmin(userId, addedBy int64) error {
+	if s.IsAdmin(userId) {
+		return nil
+	}
+
+	entity := storage.NewEntity()
+	entity["user_id"] = userId
+	entity["added_by"] = addedBy
+	entity["added_at"] = time.Now().Unix()
+
+	_, err := s.storage.Create(context.TODO(), adminsCollection, entity)
+	return err
+}
+
+// RemoveAdmin удаляет админа из хранилища, админов из конфига удалить нельзя
+func (s *Service) RemoveAdmin(userId int64) error {
+	_, err := s.storage.Delete(context.TODO(), adminsCollection, userQuery(userId))
+	if _, ok := err.(*storage.NotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// GetAdmins id админов из конфига и хранилища
+func (s *Service) GetAdmins() ([]int64, error) {
+	seen := make(map[int64]bool)
+	result := make([]int64, 0)
+	add := func(id int64) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+
+	add(s.cfg().Bot.AdminId)
+	for _, id := range s.cfg().Bot.Admins {
+		add(id)
+	}
+
+	items, err := s.storage.Get(context.TODO(), adminsCollection, 0, &storage.Condition{Field: "user_id", Operator: ">", Value: float64(0)})
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	for _, item := range items {
+		if id, ok := toInt64(item["user_id"]); ok {
+			add(id)
+		}
+	}
+
+	return result, nil
+}
+
+// SetClaimToken задает токен для /adm <токен>, пустой - если не передан генерирует случайный
+func (s *Service) SetClaimToken(token string) (string, error) {
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		token = hex.EncodeToString(buf)
+	}
+
+	s.claimMu.Lock()
+	s.claimToken = token
+	s.claimMu.Unlock()
+
+	return token, nil
+}
+
+// ClaimAdmin выдает права админа по токену, токен одноразовый
+func (s *Service) ClaimAdmin(userId int64, token string) (bool, error) {
+	s.claimMu.Lock()
+	defer s.claimMu.Unlock()
+
+	if s.claimToken == "" || subtle.ConstantTimeCompare([]byte(s.claimToken), []byte(token)) != 1 {
+		return false, nil
+	}
+
+	if err := s.AddAdmin(userId, 0); err != nil {
+		return false, err
+	}
+
+	s.claimToken = ""
+	return true, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+func TestAdmins(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	svc := NewService(nil, st, nil, &config.Config{})
+
+	if ok, err := svc.HasAdmins(); err != nil || ok {
+		t.Fatalf("expected no admins, got %v %v", ok, err)
+	}
+	if svc.IsAdmin(0) {
+		t.Error("unknown sender must not be admin")
+	}
+
+	// без токена получить права нельзя
+	if ok, _ := svc.ClaimAdmin(42, ""); ok {
+		t.Fatal("claim without token must fail")
+	}
+
+	token, err := svc.SetClaimToken("")
+	if err != nil || token == "" {
+		t.Fatalf("SetClaimToken failed: %v", err)
+	}
+
+	if ok, _ := svc.ClaimAdmin(42, "wrong"); ok {
+		t.Fatal("claim with wrong token must fail")
+	}
+	if ok, err := svc.ClaimAdmin(42, token); err != nil || !ok {
+		t.Fatalf("claim failed: %v %v", ok, err)
+	}
+	// токен одноразовый
+	if ok, _ := svc.ClaimAdmin(43, token); ok {
+		t.Fatal("token must be one-time")
+	}
+
+	if !svc.IsAdmin(42) {
+		t.Error("claimed user should be admin")
+	}
+	if ok, _ := svc.HasAdmins(); !ok {
+		t.Error("expected admins after claim")
+	}
+
+	if err := svc.AddAdmin(7, 42); err != nil {
+		t.Fatalf("AddAdmin failed: %v", err)
+	}
+	ids, err := svc.GetAdmins()
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("unexpected admins %v %v", ids, err)
+	}
+
+	if err := svc.RemoveAdmin(7); err != nil {
+		t.Fatalf("RemoveAdmin failed: %v", err)
+	}
+	if svc.IsAdmin(7) {
+		t.Error("removed admin is still admin")
+	}
+}
+
+func TestConfigAdmins(t *testing.T) {
+	svc := NewService(nil, nil, nil, &config.Config{Bot: config.BotConfig{AdminId: 1, Admins: []int64{2, 3}}})
+
+	for _, id := range []int64{1, 2, 3} {
+		if !svc.IsAdmin(id) {
+			t.Errorf("%d should be admin", id)
+		}
+	}
+	if ok, _ := svc.HasAdmins(); !ok {
+		t.Error("config admins should count")
+	}
+}
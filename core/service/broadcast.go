@@ -0,0 +1,33 @@
+package service
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// пауза между сообщениями, тг ограничивает ~30 сообщений в секунду
+const broadcastDelay = 50 * time.Millisecond
+
+// Broadcast рассылает текст всем пользователям писавшим боту
+func (s *Service) Broadcast(text string) (sent, failed int, err error) {
+	ids, err := s.GetUserIds()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i, id := range ids {
+		if i > 0 {
+			time.Sleep(broadcastDelay)
+		}
+
+		if err := s.bot.SendMessage(id, text); err != nil {
+			logrus.Debugf("рассылка: не удалось отправить %d: %v", id, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+
+	return sent, failed, nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"math/big"
+	"regexp"
 	"strconv"
 
 	"github.com/end1essrage/indigo-core/storage"
@@ -15,6 +16,8 @@ import (
 const channelAdmCollection = "channelAdm"
 const channelKey = "channel_"
 
+var channelCodeRegex = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
 type BotAdminRequest struct {
 	FromId    int64
 	ChannelId int64
@@ -28,7 +31,29 @@ type ChannelInfo struct {
 }
 
 func (s *Service) HandleBotAdd(req BotAdminRequest) {
-	code := genCode()
+	// бота могли повторно назначить админом - код сохраняем
+	existing, err := s.GetChannel(req.ChannelId)
+	if err != nil {
+		logrus.Errorf("ошибка поиска канала %d: %v", req.ChannelId, err)
+		return
+	}
+
+	if existing != nil {
+		update := storage.NewEntity()
+		update["title"] = req.Title
+		if _, err := s.storage.Update(context.TODO(), channelAdmCollection, channelQuery(req.ChannelId), update); err != nil {
+			logrus.Errorf("ошибка обновления канала %d: %v", req.ChannelId, err)
+		}
+		s.bot.SendMessage(req.FromId, fmt.Sprintf("Бот снова админ в канале %s с кодом %s", req.Title, existing["code"]))
+		return
+	}
+
+	code, err := s.uniqueCode()
+	if err != nil {
+		logrus.Errorf("ошибка генерации кода канала: %v", err)
+		return
+	}
+
 	//сохранить канал с каким-то кодо
 	entity := storage.NewEntity()
 	entity["chan_id"] = req.ChannelId
@@ -37,34 +62,22 @@ func (s *Service) HandleBotAdd(req BotAdminRequest) {
 
 	id, err := s.storage.Create(context.TODO(), channelAdmCollection, entity)
 	if err != nil {
-		logrus.Errorf("ошибка создания записи")
+		logrus.Errorf("ошибка создания записи канала: %v", err)
+		return
 	}
 
 	logrus.Infof("id документа %s", id)
 
-	//отправить сообщение админу в личку тому кто добавил
+	//отправить сообщение админу в личку тому кто добавил, код можно поменять в админ меню
 	s.bot.SendMessage(req.FromId, fmt.Sprintf("Бот добавлен в канал %s с кодом %s ", req.Title, code))
-
-	//Далее через админ меню - в виде клавиатуры(куда то надо засунуть в интернал ее опеределенние)
-	//можно выбрать настройку каналов, получить список каналов в виде кнопок
-	//при выборе канала появляется форма с одним шагом - ввести новое кодовое название канала
-
-	//либо изменить генерацию кода для канала и позволить админам лишь просматривать его код
-	//в таком случае админ меню содержит кнопки при нажатии кнопки с каналами мы просто получаем и выводим их список
-
-	//как можно улучшить работу для админа, по сути нам нужен форм воркер который в конце не выполнит скрипт, а запустит го код и соберет данные формы
-	//может позволить форм воркеру создаваться с колюэком в виде го функции?
-
-	// проще всего сделать через форм воркер может отдельную реализацию или отдельный тип форм
-
-	//считать заданный код и присвоить сохраненному каналу
-
-	//отправлять в канал можно в луа по коду
 }
 
 func (s *Service) GetChannels() ([]s.Entity, error) {
 	items, err := s.storage.Get(context.TODO(), channelAdmCollection, 0, nil)
 	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return []storage.Entity{}, nil
+		}
 		logrus.Errorf("ошибка получения каналов")
 		return nil, err
 	}
@@ -72,6 +85,19 @@ func (s *Service) GetChannels() ([]s.Entity, error) {
 	return items, nil
 }
 
+// GetChannel запись канала, nil если бот не добавлен в канал
+func (s *Service) GetChannel(chanId int64) (s.Entity, error) {
+	item, err := s.storage.GetOne(context.TODO(), channelAdmCollection, channelQuery(chanId))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return item, nil
+}
+
 func (s *Service) GetChannelId(code string) (int64, error) {
 	//Проверить в кэше
 	id := s.cache.GetString(channelKey + code)
@@ -88,20 +114,134 @@ func (s *Service) GetChannelId(code string) (int64, error) {
 		return 0, err
 	}
 
-	chanId, ok := item["chan_id"]
+	chanId, ok := toInt64(item["chan_id"])
 	if !ok {
 		return 0, fmt.Errorf("нет поля chan_id")
 	}
 	//обновитю кэш и вернуть
-	s.cache.SetString(channelKey+code, strconv.FormatInt(chanId.(int64), 10))
-	return chanId.(int64), nil
+	s.cache.SetString(channelKey+code, strconv.FormatInt(chanId, 10))
+	return chanId, nil
+}
+
+// SetChannelCode задает каналу читаемый код для скриптов, код должен быть уникальным
+func (s *Service) SetChannelCode(chanId int64, code string) error {
+	if !channelCodeRegex.MatchString(code) {
+		return fmt.Errorf("код может содержать латиницу, цифры и _, от 2 до 32 символов")
+	}
+
+	channel, err := s.GetChannel(chanId)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return fmt.Errorf("канал %d не найден", chanId)
+	}
+
+	if channel["code"] == code {
+		return nil
+	}
+
+	taken, err := s.codeTaken(code)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("код %s уже занят", code)
+	}
+
+	update := storage.NewEntity()
+	update["code"] = code
+	if _, err := s.storage.Update(context.TODO(), channelAdmCollection, channelQuery(chanId), update); err != nil {
+		return err
+	}
+
+	s.invalidateChannel(channel)
+	return nil
 }
 
+// RemoveChannel удаляет запись канала и сбрасывает кэш его кода
+func (s *Service) RemoveChannel(chanId int64) error {
+	channel, err := s.GetChannel(chanId)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return nil
+	}
+
+	if _, err := s.storage.Delete(context.TODO(), channelAdmCollection, channelQuery(chanId)); err != nil {
+		if _, ok := err.(*storage.NotFoundError); !ok {
+			return err
+		}
+	}
+
+	s.invalidateChannel(channel)
+	return nil
+}
+
+// HandleBotRemove бот вышел, был удален или лишен прав админа
 func (s *Service) HandleBotRemove(req BotAdminRequest) {
-	//удалить из базы
+	channel, err := s.GetChannel(req.ChannelId)
+	if err != nil {
+		logrus.Errorf("ошибка поиска канала %d: %v", req.ChannelId, err)
+		return
+	}
+	if channel == nil {
+		return
+	}
+
+	if err := s.RemoveChannel(req.ChannelId); err != nil {
+		logrus.Errorf("ошибка удаления канала %d: %v", req.ChannelId, err)
+		return
+	}
+
+	logrus.Infof("канал %d (%v) удален", req.ChannelId, channel["code"])
 	s.bot.SendMessage(req.FromId, fmt.Sprintf("Бот был удален из канала %s", req.Title))
 }
 
+func (s *Service) invalidateChannel(channel storage.Entity) {
+	if code, ok := channel["code"].(string); ok && code != "" {
+		if err := s.cache.Delete(channelKey + code); err != nil {
+			logrus.Errorf("ошибка сброса кэша канала %s: %v", code, err)
+		}
+	}
+}
+
+func (s *Service) codeTaken(code string) (bool, error) {
+	_, err := s.storage.GetOne(context.TODO(), channelAdmCollection, &storage.Condition{Field: "code", Operator: "=", Value: code})
+	if err == nil {
+		return true, nil
+	}
+	if _, ok := err.(*storage.NotFoundError); ok {
+		return false, nil
+	}
+	return false, err
+}
+
+// uniqueCode случайный код, не совпадающий с уже выданными
+func (s *Service) uniqueCode() (string, error) {
+	for i := 0; i < 10; i++ {
+		code := genCode()
+		if code == "" {
+			continue
+		}
+
+		taken, err := s.codeTaken(code)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("не удалось подобрать свободный код")
+}
+
+func channelQuery(chanId int64) storage.QueryNode {
+	return &storage.Condition{Field: "chan_id", Operator: "=", Value: float64(chanId)}
+}
+
 func genCode() string {
 	letters := "abcdefghijklmnopqrstuvwxyz"
 	bytes := make([]byte, 3)
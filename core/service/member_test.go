@@ -0,0 +1,83 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	b "github.com/end1essrage/indigo-core/bot"
+	"github.com/end1essrage/indigo-core/cache"
+	"github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+type fakeBot struct {
+	messages []string
+}
+
+func (f *fakeBot) SendMessage(chatId int64, text string) error {
+	f.messages = append(f.messages, text)
+	return nil
+}
+
+func (f *fakeBot) SendKeyboard(chatId int64, text string, mesh b.MeshInlineKeyboard) error {
+	return nil
+}
+
+func TestChannelLifecycle(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	c := cache.NewInMemoryCache(time.Minute)
+	defer c.Stop()
+
+	svc := NewService(&fakeBot{}, st, c, &config.Config{})
+	req := BotAdminRequest{FromId: 1, ChannelId: -100, Title: "news"}
+
+	svc.HandleBotAdd(req)
+	// повторное назначение не создает второй записи
+	svc.HandleBotAdd(req)
+
+	channels, err := svc.GetChannels()
+	if err != nil || len(channels) != 1 {
+		t.Fatalf("expected one channel, got %v %v", channels, err)
+	}
+	oldCode := channels[0]["code"].(string)
+
+	if id, err := svc.GetChannelId(oldCode); err != nil || id != -100 {
+		t.Fatalf("GetChannelId failed: %v %v", id, err)
+	}
+
+	if err := svc.SetChannelCode(-100, "Bad Code"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+	if err := svc.SetChannelCode(-100, "news_main"); err != nil {
+		t.Fatalf("SetChannelCode failed: %v", err)
+	}
+
+	// старый код сброшен из кэша и больше не находится
+	if _, err := svc.GetChannelId(oldCode); err == nil {
+		t.Error("old code should not resolve after rename")
+	}
+	if id, err := svc.GetChannelId("news_main"); err != nil || id != -100 {
+		t.Fatalf("new code does not resolve: %v %v", id, err)
+	}
+
+	svc.HandleBotAdd(BotAdminRequest{FromId: 1, ChannelId: -200, Title: "other"})
+	if err := svc.SetChannelCode(-200, "news_main"); err == nil {
+		t.Error("expected error for taken code")
+	}
+
+	svc.HandleBotRemove(req)
+	if ch, _ := svc.GetChannel(-100); ch != nil {
+		t.Error("channel should be removed")
+	}
+	if _, err := svc.GetChannelId("news_main"); err == nil {
+		t.Error("removed channel code should not resolve")
+	}
+
+	svc.HandleBotRemove(BotAdminRequest{FromId: 1, ChannelId: -200})
+	if channels, err := svc.GetChannels(); err != nil || len(channels) != 0 {
+		t.Errorf("expected no channels, got %v %v", channels, err)
+	}
+}
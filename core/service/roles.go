@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+const rolesCollection = "roles"
+
+// HasRole проверяет выдана ли пользователю роль
+func (s *Service) HasRole(userId int64, role string) (bool, error) {
+	if s.IsAdmin(userId) {
+		return true, nil
+	}
+
+	_, err := s.storage.GetOne(context.TODO(), rolesCollection, roleQuery(userId, role))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// HasAnyRole true если список пуст или у пользователя есть хотя бы одна из ролей
+func (s *Service) HasAnyRole(userId int64, roles []string) (bool, error) {
+	if len(roles) == 0 {
+		return true, nil
+	}
+
+	for _, role := range roles {
+		ok, err := s.HasRole(userId, role)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetRoles роли выданные пользователю
+func (s *Service) GetRoles(userId int64) ([]string, error) {
+	items, err := s.storage.Get(context.TODO(), rolesCollection, 0, userQuery(userId))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if role, ok := item["role"].(string); ok {
+			result = append(result, role)
+		}
+	}
+
+	return result, nil
+}
+
+// SetRole выдает роль, повторная выдача ничего не меняет
+func (s *Service) SetRole(userId int64, role string) error {
+	if _, ok := s.cfg().Roles[role]; !ok {
+		return fmt.Errorf("роль %s не объявлена в конфиге", role)
+	}
+
+	_, err := s.storage.GetOne(context.TODO(), rolesCollection, roleQuery(userId, role))
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*storage.NotFoundError); !ok {
+		return err
+	}
+
+	entity := storage.NewEntity()
+	entity["user_id"] = userId
+	entity["role"] = role
+
+	_, err = s.storage.Create(context.TODO(), rolesCollection, entity)
+	return err
+}
+
+// RemoveRole забирает роль у пользователя
+func (s *Service) RemoveRole(userId int64, role string) error {
+	_, err := s.storage.Delete(context.TODO(), rolesCollection, roleQuery(userId, role))
+	if _, ok := err.(*storage.NotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+func roleQuery(userId int64, role string) storage.QueryNode {
+	return &storage.BinaryOp{
+		Operator: "AND",
+		Left:     userQuery(userId),
+		Right:    &storage.Condition{Field: "role", Operator: "=", Value: role},
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
+)
+
+func TestRoles(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		Bot:   config.BotConfig{AdminId: 1},
+		Roles: map[string]*config.Role{"manager": {Name: "manager"}, "vip": {Name: "vip"}},
+	}
+	svc := NewService(nil, st, nil, cfg)
+
+	if ok, err := svc.HasRole(42, "manager"); err != nil || ok {
+		t.Fatalf("expected no role before grant, got %v %v", ok, err)
+	}
+
+	if err := svc.SetRole(42, "manager"); err != nil {
+		t.Fatalf("SetRole failed: %v", err)
+	}
+	// повторная выдача не дублирует запись
+	if err := svc.SetRole(42, "manager"); err != nil {
+		t.Fatalf("SetRole failed: %v", err)
+	}
+	if err := svc.SetRole(42, "unknown"); err == nil {
+		t.Error("expected error for undeclared role")
+	}
+
+	roles, err := svc.GetRoles(42)
+	if err != nil || len(roles) != 1 || roles[0] != "manager" {
+		t.Fatalf("unexpected roles %v %v", roles, err)
+	}
+
+	if ok, _ := svc.HasAnyRole(42, []string{"vip", "manager"}); !ok {
+		t.Error("expected access with one of roles")
+	}
+	if ok, _ := svc.HasAnyRole(42, []string{"vip"}); ok {
+		t.Error("expected no access without role")
+	}
+	if ok, _ := svc.HasAnyRole(7, nil); !ok {
+		t.Error("empty roles should allow everyone")
+	}
+	if ok, _ := svc.HasRole(1, "vip"); !ok {
+		t.Error("admin should have every role")
+	}
+
+	if err := svc.RemoveRole(42, "manager"); err != nil {
+		t.Fatalf("RemoveRole failed: %v", err)
+	}
+	if ok, _ := svc.HasRole(42, "manager"); ok {
+		t.Error("role should be removed")
+	}
+}
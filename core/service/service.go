@@ -1,8 +1,13 @@
 package service
 
 import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
 	b "github.com/end1essrage/indigo-core/bot"
 	c "github.com/end1essrage/indigo-core/cache"
+	"github.com/end1essrage/indigo-core/config"
 	s "github.com/end1essrage/indigo-core/storage"
 )
 
@@ -11,8 +16,20 @@ type Service struct {
 	bot     Bot
 	storage s.Storage
 	cache   c.Cache
+	config  *config.Config
+	cfgMu   sync.RWMutex
+
+	// одноразовый токен для получения прав админа
+	claimMu    sync.Mutex
+	claimToken string
+
+	// чтение и запись профиля одного пользователя не пересекаются, блокировки разбиты по id
+	userLocks [userLockStripes]sync.Mutex
 }
 
+// число блокировок пользователей, память не растет с числом пользователей
+const userLockStripes = 64
+
 type ChatMemberService interface {
 	HandleBotAdm()
 	GetChannels() ([]s.Entity, error)
@@ -24,6 +41,40 @@ type Bot interface {
 	SendKeyboard(chatId int64, text string, mesh b.MeshInlineKeyboard) error
 }
 
-func NewService(bot Bot, storage s.Storage, cache c.Cache) *Service {
-	return &Service{bot: bot, storage: storage, cache: cache}
+func NewService(bot Bot, storage s.Storage, cache c.Cache, config *config.Config) *Service {
+	return &Service{bot: bot, storage: storage, cache: cache, config: config}
+}
+
+// SetConfig подменяет конфиг после перезагрузки
+func (s *Service) SetConfig(config *config.Config) {
+	s.cfgMu.Lock()
+	s.config = config
+	s.cfgMu.Unlock()
+}
+
+func (s *Service) cfg() *config.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.config
+}
+
+// toInt64 числа из хранилища приходят разными типами (файл - float64, монга - int64)
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
 }
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultUsersCollection = "users"
+
+// счетчики активности пользователя
+const (
+	UserCounter_Messages  = "messages"
+	UserCounter_Callbacks = "callbacks"
+)
+
+// TrackUser создает или обновляет профиль пользователя, counter - какой счетчик увеличить (пустой - никакой)
+// в хранилище нет атомарного инкремента, поэтому чтение и запись счетчика идут под блокировкой пользователя
+func (s *Service) TrackUser(user *tgbotapi.User, counter string) error {
+	mu := &s.userLocks[uint64(user.ID)%userLockStripes]
+	mu.Lock()
+	defer mu.Unlock()
+
+	ctx := context.TODO()
+	collection := s.usersCollection()
+	now := time.Now().Unix()
+
+	existing, err := s.storage.GetOne(ctx, collection, userQuery(user.ID))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); !ok {
+			return err
+		}
+
+		entity := storage.NewEntity()
+		entity["user_id"] = user.ID
+		fillUserProfile(entity, user)
+		entity["first_seen"] = now
+		entity["last_seen"] = now
+		entity[UserCounter_Messages] = 0
+		entity[UserCounter_Callbacks] = 0
+		if counter != "" {
+			entity[counter] = 1
+		}
+
+		_, err := s.storage.Create(ctx, collection, entity)
+		if err == nil {
+			logrus.Debugf("новый пользователь %d", user.ID)
+		}
+		return err
+	}
+
+	entity := storage.NewEntity()
+	fillUserProfile(entity, user)
+	entity["last_seen"] = now
+	if counter != "" {
+		current, _ := toInt64(existing[counter])
+		entity[counter] = current + 1
+	}
+
+	_, err = s.storage.Update(ctx, collection, userQuery(user.ID), entity)
+	return err
+}
+
+// GetUser профиль пользователя, nil если пользователь ни разу не писал боту
+func (s *Service) GetUser(id int64) (storage.Entity, error) {
+	user, err := s.storage.GetOne(context.TODO(), s.usersCollection(), userQuery(id))
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserIds id всех пользователей писавших боту
+func (s *Service) GetUserIds() ([]int64, error) {
+	users, err := s.allUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]int64, 0, len(users))
+	for _, u := range users {
+		if id, ok := toInt64(u["user_id"]); ok {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// UsersStats всего пользователей и сколько из них были активны начиная с since (unix)
+func (s *Service) UsersStats(since int64) (total, active int, err error) {
+	users, err := s.allUsers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, u := range users {
+		if seen, ok := toInt64(u["last_seen"]); ok && seen >= since {
+			active++
+		}
+	}
+
+	return len(users), active, nil
+}
+
+func (s *Service) allUsers() ([]storage.Entity, error) {
+	users, err := s.storage.Get(context.TODO(), s.usersCollection(), 0, &storage.Condition{Field: "user_id", Operator: ">", Value: float64(0)})
+	if err != nil {
+		if _, ok := err.(*storage.NotFoundError); ok {
+			return []storage.Entity{}, nil
+		}
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *Service) usersCollection() string {
+	return s.cfg().ModuleOption(config.TRACK_USER, "collection", defaultUsersCollection)
+}
+
+// в файловом хранилище числа читаются как float64, монга сравнивает числа любых типов
+func userQuery(id int64) storage.QueryNode {
+	return &storage.Condition{Field: "user_id", Operator: "=", Value: float64(id)}
+}
+
+func fillUserProfile(entity storage.Entity, user *tgbotapi.User) {
+	entity["username"] = user.UserName
+	entity["first_name"] = user.FirstName
+	entity["last_name"] = user.LastName
+	entity["language"] = user.LanguageCode
+	entity["is_bot"] = user.IsBot
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/end1essrage/indigo-core/config"
+	"github.com/end1essrage/indigo-core/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestTrackUser(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{Modules: []config.ModuleConfig{
+		{Name: config.TRACK_USER, Cfg: map[string]string{"collection": "profiles"}},
+	}}
+	svc := NewService(nil, st, nil, cfg)
+
+	user := &tgbotapi.User{ID: 42, UserName: "eric", FirstName: "Eric", LanguageCode: "ru"}
+
+	if u, err := svc.GetUser(42); err != nil || u != nil {
+		t.Fatalf("expected no user before tracking, got %v %v", u, err)
+	}
+
+	for _, counter := range []string{UserCounter_Messages, UserCounter_Messages, UserCounter_Callbacks} {
+		if err := svc.TrackUser(user, counter); err != nil {
+			t.Fatalf("TrackUser failed: %v", err)
+		}
+	}
+
+	user.UserName = "eric_new"
+	if err := svc.TrackUser(user, ""); err != nil {
+		t.Fatalf("TrackUser failed: %v", err)
+	}
+
+	u, err := svc.GetUser(42)
+	if err != nil || u == nil {
+		t.Fatalf("GetUser failed: %v %v", u, err)
+	}
+
+	if u["username"] != "eric_new" {
+		t.Errorf("username was not updated: %v", u["username"])
+	}
+	if n, _ := toInt64(u[UserCounter_Messages]); n != 2 {
+		t.Errorf("expected 2 messages, got %v", u[UserCounter_Messages])
+	}
+	if n, _ := toInt64(u[UserCounter_Callbacks]); n != 1 {
+		t.Errorf("expected 1 callback, got %v", u[UserCounter_Callbacks])
+	}
+	if u["first_seen"] == nil || u["last_seen"] == nil {
+		t.Error("seen timestamps should be set")
+	}
+
+	ids, err := st.GetIds(t.Context(), "profiles", 0, nil)
+	if err != nil || len(ids) != 1 {
+		t.Errorf("expected exactly one profile, got %v %v", ids, err)
+	}
+}
+
+func TestTrackUserConcurrent(t *testing.T) {
+	st, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	svc := NewService(nil, st, nil, &config.Config{})
+	user := &tgbotapi.User{ID: 7, FirstName: "Ann"}
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.TrackUser(user, UserCounter_Messages); err != nil {
+				t.Errorf("TrackUser failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	u, err := svc.GetUser(7)
+	if err != nil || u == nil {
+		t.Fatalf("GetUser failed: %v %v", u, err)
+	}
+	if got, _ := toInt64(u[UserCounter_Messages]); got != n {
+		t.Errorf("expected %d messages, got %v", n, u[UserCounter_Messages])
+	}
+
+	ids, err := st.GetIds(t.Context(), defaultUsersCollection, 0, nil)
+	if err != nil || len(ids) != 1 {
+		t.Errorf("expected exactly one profile, got %v %v", ids, err)
+	}
+}
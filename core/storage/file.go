@@ -34,8 +34,9 @@ func (fs *FileStorage) Get(ctx context.Context, collection string, count int, qu
 
 	collectionPath := filepath.Join(fs.basePath, collection)
 
+	// пустая коллекция ведет себя как в монге - ничего не найдено
 	if _, err := os.Stat(collectionPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("коллекция не существует: %w", err)
+		return nil, NewNotFoundError(fmt.Sprintf("коллекция %s не существует", collection))
 	}
 
 	files, err := fs.listCollectionFiles(collectionPath)
@@ -44,7 +45,7 @@ func (fs *FileStorage) Get(ctx context.Context, collection string, count int, qu
 	}
 
 	if len(files) == 0 {
-		return nil, NewNotFoundError(query.ToString())
+		return nil, NewNotFoundError(fmt.Sprintf("коллекция %s пуста", collection))
 	}
 
 	results := make([]Entity, 0, count)
@@ -80,8 +81,9 @@ func (fs *FileStorage) GetOne(ctx context.Context, collection string, query Quer
 
 	collectionPath := filepath.Join(fs.basePath, collection)
 
+	// пустая коллекция ведет себя как в монге - ничего не найдено
 	if _, err := os.Stat(collectionPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("коллекция не существует: %w", err)
+		return nil, NewNotFoundError(fmt.Sprintf("коллекция %s не существует", collection))
 	}
 
 	files, err := fs.listCollectionFiles(collectionPath)
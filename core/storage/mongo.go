@@ -179,7 +179,7 @@ func (fs *MongoStorage) GetOne(ctx context.Context, collection string, query Que
 	} else if err != nil {
 		err := fmt.Errorf("непридвиденная ошибка %w", err)
 
-		logrus.Errorf("getone err %w", err)
+		logrus.Errorf("getone err %v", err)
 
 		return nil, err
 	}
@@ -192,7 +192,7 @@ func (fs *MongoStorage) GetOne(ctx context.Context, collection string, query Que
 func (fs *MongoStorage) GetById(ctx context.Context, collection string, id string) (Entity, error) {
 	oid, err := bson.ObjectIDFromHex(id)
 	if err != nil {
-		logrus.Errorf("Getbyid err: %w", err)
+		logrus.Errorf("Getbyid err: %v", err)
 		return nil, err
 	}
 	return fs.GetOne(ctx, collection, &Condition{"_id", "=", oid})
@@ -0,0 +1,342 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Проверки ввода этапов форм, правило задается в конфиге этапа (validation: {type: ..., ...})
+//Правила проверяются при загрузке конфига, поэтому пакет не зависит от движка луа - скрипты запускает ScriptRunner
+
+const (
+	Type_String = "string"
+	Type_Length = "length"
+	Type_Email  = "email"
+	Type_Number = "number"
+	Type_Range  = "range"
+	Type_Regex  = "regex"
+	Type_Phone  = "phone"
+	Type_Date   = "date"
+	Type_Enum   = "enum"
+	Type_Lua    = "lua"
+
+	// формат даты по умолчанию, в терминах go (ДД.ММ.ГГГГ)
+	defaultDateLayout = "02.01.2006"
+)
+
+// Error ошибка проверки, текст показывается пользователю
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...any) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// Check проверяет значение, nil - значение подходит
+type Check func(value string) error
+
+// Builder собирает проверку из параметров правила, ошибка - некорректное правило в конфиге
+type Builder func(rule Rule, r *Registry) (Check, error)
+
+// ScriptRunner запускает луа скрипт проверки со значением, скрипт возвращает true/nil или текст ошибки
+type ScriptRunner func(script, value string) (interface{}, error)
+
+type Registry struct {
+	builders map[string]Builder
+	scripts  ScriptRunner
+}
+
+// NewRegistry реестр со встроенными проверками, scripts может быть nil (только проверка конфига)
+func NewRegistry(scripts ScriptRunner) *Registry {
+	return &Registry{
+		scripts: scripts,
+		builders: map[string]Builder{
+			Type_String: buildLength,
+			Type_Length: buildLength,
+			Type_Email:  buildEmail,
+			Type_Number: buildNumber,
+			Type_Range:  buildNumber,
+			Type_Regex:  buildRegex,
+			Type_Phone:  buildPhone,
+			Type_Date:   buildDate,
+			Type_Enum:   buildEnum,
+			Type_Lua:    buildLua,
+		},
+	}
+}
+
+// Register добавляет или заменяет проверку
+func (r *Registry) Register(name string, b Builder) {
+	r.builders[name] = b
+}
+
+// Build проверка по правилу из конфига
+func (r *Registry) Build(rules map[string]any) (Check, error) {
+	rule := Rule(rules)
+	name, _ := rule.String("type")
+	if name == "" {
+		return nil, fmt.Errorf("не задан type проверки")
+	}
+
+	b, ok := r.builders[name]
+	if !ok {
+		return nil, fmt.Errorf("неизвестная проверка %s", name)
+	}
+	return b(rule, r)
+}
+
+// Rule параметры правила как их разобрал yaml (числа бывают int, uint64, float64)
+type Rule map[string]any
+
+func (r Rule) String(key string) (string, bool) {
+	v, ok := r[key]
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+func (r Rule) Float(key string) (float64, bool, error) {
+	v, ok := r[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	switch n := v.(type) {
+	case int:
+		return float64(n), true, nil
+	case int64:
+		return float64(n), true, nil
+	case uint64:
+		return float64(n), true, nil
+	case float64:
+		return n, true, nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s должно быть числом", key)
+		}
+		return f, true, nil
+	}
+	return 0, false, fmt.Errorf("%s должно быть числом", key)
+}
+
+func (r Rule) Strings(key string) ([]string, error) {
+	v, ok := r[key]
+	if !ok {
+		return nil, nil
+	}
+
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s должно быть списком", key)
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, fmt.Sprint(item))
+	}
+	return result, nil
+}
+
+// bounds min/max правила, отсутствующая граница не проверяется
+func bounds(rule Rule, minKey, maxKey string) (min, max *float64, err error) {
+	if v, ok, err := rule.Float(minKey); err != nil {
+		return nil, nil, err
+	} else if ok {
+		min = &v
+	}
+	if v, ok, err := rule.Float(maxKey); err != nil {
+		return nil, nil, err
+	} else if ok {
+		max = &v
+	}
+	if min != nil && max != nil && *min > *max {
+		return nil, nil, fmt.Errorf("%s больше %s", minKey, maxKey)
+	}
+	return min, max, nil
+}
+
+func buildLength(rule Rule, _ *Registry) (Check, error) {
+	min, max, err := bounds(rule, "min_length", "max_length")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(value string) error {
+		n := float64(len([]rune(value)))
+		switch {
+		case min != nil && n < *min:
+			return invalid("Слишком коротко, нужно не меньше %g символов", *min)
+		case max != nil && n > *max:
+			return invalid("Слишком длинно, нужно не больше %g символов", *max)
+		}
+		return nil
+	}, nil
+}
+
+func buildEmail(_ Rule, _ *Registry) (Check, error) {
+	return func(value string) error {
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+			return invalid("Введите корректный email")
+		}
+		return nil
+	}, nil
+}
+
+func buildNumber(rule Rule, _ *Registry) (Check, error) {
+	min, max, err := bounds(rule, "min", "max")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(value string) error {
+		n, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", "."), 64)
+		switch {
+		case err != nil:
+			return invalid("Введите число")
+		case min != nil && n < *min:
+			return invalid("Число должно быть не меньше %g", *min)
+		case max != nil && n > *max:
+			return invalid("Число должно быть не больше %g", *max)
+		}
+		return nil
+	}, nil
+}
+
+func buildRegex(rule Rule, _ *Registry) (Check, error) {
+	pattern, ok := rule.String("pattern")
+	if !ok || pattern == "" {
+		return nil, fmt.Errorf("для regex нужен pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("невалидная регулярка: %w", err)
+	}
+
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return invalid("Неверный формат")
+		}
+		return nil
+	}, nil
+}
+
+var phoneJunk = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+
+// buildPhone международный номер: необязательный +, от 10 до 15 цифр, пробелы, скобки и дефисы допускаются
+func buildPhone(_ Rule, _ *Registry) (Check, error) {
+	re := regexp.MustCompile(`^\+?\d{10,15}$`)
+	return func(value string) error {
+		if !re.MatchString(phoneJunk.Replace(value)) {
+			return invalid("Введите номер телефона, например +7 900 123-45-67")
+		}
+		return nil
+	}, nil
+}
+
+func buildDate(rule Rule, _ *Registry) (Check, error) {
+	layout, ok := rule.String("layout")
+	if !ok || layout == "" {
+		layout = defaultDateLayout
+	}
+
+	parse := func(key string) (*time.Time, error) {
+		s, ok := rule.String(key)
+		if !ok {
+			return nil, nil
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s не в формате %s", key, layout)
+		}
+		return &t, nil
+	}
+	min, err := parse("min")
+	if err != nil {
+		return nil, err
+	}
+	max, err := parse("max")
+	if err != nil {
+		return nil, err
+	}
+
+	// пример формата для пользователя
+	example := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC).Format(layout)
+
+	return func(value string) error {
+		t, err := time.Parse(layout, strings.TrimSpace(value))
+		switch {
+		case err != nil:
+			return invalid("Введите дату в формате %s", example)
+		case min != nil && t.Before(*min):
+			return invalid("Дата должна быть не раньше %s", min.Format(layout))
+		case max != nil && t.After(*max):
+			return invalid("Дата должна быть не позже %s", max.Format(layout))
+		}
+		return nil
+	}, nil
+}
+
+func buildEnum(rule Rule, _ *Registry) (Check, error) {
+	values, err := rule.Strings("values")
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("для enum нужен список values")
+	}
+	ignoreCase, _ := rule["ignore_case"].(bool)
+
+	return func(value string) error {
+		for _, v := range values {
+			if v == value || (ignoreCase && strings.EqualFold(v, value)) {
+				return nil
+			}
+		}
+		return invalid("Выберите один из вариантов: %s", strings.Join(values, ", "))
+	}, nil
+}
+
+// buildLua скрипт получает значение в ctx.text
+func buildLua(rule Rule, r *Registry) (Check, error) {
+	script, ok := rule.String("script")
+	if !ok || script == "" {
+		return nil, fmt.Errorf("для lua нужен script")
+	}
+
+	return func(value string) error {
+		if r.scripts == nil {
+			return errors.New("скрипты проверки недоступны")
+		}
+
+		result, err := r.scripts(script, value)
+		if err != nil {
+			return err
+		}
+
+		switch v := result.(type) {
+		case nil:
+			return nil
+		case bool:
+			if v {
+				return nil
+			}
+		case string:
+			return invalid("%s", v)
+		}
+		return invalid("Неверное значение")
+	}, nil
+}
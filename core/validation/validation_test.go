@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	registry := NewRegistry(func(script, value string) (interface{}, error) {
+		if value == "ok" {
+			return true, nil
+		}
+		return "ИНН не найден", nil
+	})
+
+	testCases := []struct {
+		name  string
+		rule  map[string]any
+		value string
+		valid bool
+	}{
+		{name: "min length uint64 from yaml", rule: map[string]any{"type": "string", "min_length": uint64(2)}, value: "a", valid: false},
+		{name: "max length counts runes", rule: map[string]any{"type": "length", "max_length": 3}, value: "абв", valid: true},
+		{name: "email", rule: map[string]any{"type": "email"}, value: "user@mail.ru", valid: true},
+		{name: "bad email", rule: map[string]any{"type": "email"}, value: "user@mail", valid: false},
+		{name: "number in range", rule: map[string]any{"type": "number", "min": uint64(14), "max": uint64(120)}, value: "18", valid: true},
+		{name: "number below range", rule: map[string]any{"type": "range", "min": 14}, value: "12,5", valid: false},
+		{name: "not a number", rule: map[string]any{"type": "number"}, value: "много", valid: false},
+		{name: "regex", rule: map[string]any{"type": "regex", "pattern": `^\d{6}$`}, value: "123456", valid: true},
+		{name: "phone with formatting", rule: map[string]any{"type": "phone"}, value: "+7 (900) 123-45-67", valid: true},
+		{name: "short phone", rule: map[string]any{"type": "phone"}, value: "12345", valid: false},
+		{name: "date default layout", rule: map[string]any{"type": "date"}, value: "31.12.2024", valid: true},
+		{name: "date custom layout", rule: map[string]any{"type": "date", "layout": "2006-01-02"}, value: "31.12.2024", valid: false},
+		{name: "date after max", rule: map[string]any{"type": "date", "max": "01.01.2020"}, value: "02.01.2020", valid: false},
+		{name: "enum ignore case", rule: map[string]any{"type": "enum", "values": []any{"Да", "Нет"}, "ignore_case": true}, value: "да", valid: true},
+		{name: "enum", rule: map[string]any{"type": "enum", "values": []any{"Да", "Нет"}}, value: "Может", valid: false},
+		{name: "lua ok", rule: map[string]any{"type": "lua", "script": "inn"}, value: "ok", valid: true},
+		{name: "lua message", rule: map[string]any{"type": "lua", "script": "inn"}, value: "000", valid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check, err := registry.Build(tc.rule)
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+
+			err = check(tc.value)
+			if (err == nil) != tc.valid {
+				t.Fatalf("err = %v, want valid %v", err, tc.valid)
+			}
+
+			var vErr *Error
+			if err != nil && (!errors.As(err, &vErr) || vErr.Message == "") {
+				t.Errorf("expected user message, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	registry := NewRegistry(nil)
+
+	testCases := []struct {
+		name string
+		rule map[string]any
+	}{
+		{name: "no type", rule: map[string]any{}},
+		{name: "unknown type", rule: map[string]any{"type": "photo"}},
+		{name: "regex without pattern", rule: map[string]any{"type": "regex"}},
+		{name: "broken regex", rule: map[string]any{"type": "regex", "pattern": "("}},
+		{name: "min over max", rule: map[string]any{"type": "number", "min": 10, "max": 1}},
+		{name: "min not a number", rule: map[string]any{"type": "string", "min_length": "два"}},
+		{name: "enum without values", rule: map[string]any{"type": "enum"}},
+		{name: "date bound in other layout", rule: map[string]any{"type": "date", "min": "2020-01-01"}},
+		{name: "lua without script", rule: map[string]any{"type": "lua"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := registry.Build(tc.rule); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registry := NewRegistry(nil)
+	registry.Register("inn", func(rule Rule, _ *Registry) (Check, error) {
+		return func(value string) error {
+			if len(value) != 10 && len(value) != 12 {
+				return &Error{Message: "ИНН состоит из 10 или 12 цифр"}
+			}
+			return nil
+		}, nil
+	})
+
+	check, err := registry.Build(map[string]any{"type": "inn"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if check("7707083893") != nil || check("123") == nil {
+		t.Error("custom check works incorrectly")
+	}
+}
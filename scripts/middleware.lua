@@ -1,5 +1,13 @@
 local function handle()
     log("Скрипт запущен! moddleware")
+
+    -- пример: режем сообщения со ссылками от неизвестных
+    if ctx.text ~= nil and string.find(ctx.text, "http") then
+        return "stop"
+    end
+
+    -- обогащаем контекст для обработчиков (ctx.data.checked)
+    return {verdict = "rewrite", data = {checked = true}}
 end
 
-handle()
\ No newline at end of file
+return handle()